@@ -1,21 +1,34 @@
 // Package afdata implements Agent-First Data (AFDATA) output formatting
 // and protocol templates.
 //
-// 13 public APIs and 2 types: 3 protocol builders + 4 output formatters +
-// 1 redaction + 1 utility + 4 CLI helpers + OutputFormat + RedactionPolicy.
+// It provides protocol builders, output formatters, secret redaction,
+// size parsing and CLI helpers, plus the OutputFormat and RedactionPolicy
+// types and an AFDATA slog handler.
 package afdata
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"math"
+	"math/big"
 	"math/bits"
+	"path"
 	"reflect"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
 	"unicode/utf16"
+	"unicode/utf8"
 )
 
 // ═══════════════════════════════════════════
@@ -31,6 +44,13 @@ func BuildJsonOk(result any, trace any) map[string]any {
 	return m
 }
 
+// BuildJsonOkTrace builds {code: "ok", result, trace} from a Trace builder.
+// The trace always carries duration_ms (0 unless set); a nil t yields
+// {duration_ms: 0}.
+func BuildJsonOkTrace(result any, t *Trace) map[string]any {
+	return BuildJsonOk(result, t.Map())
+}
+
 // BuildJsonError builds {code: "error", error: message, hint?, trace?}.
 // Pass empty string for hint to omit it.
 func BuildJsonError(message string, hint string, trace any) map[string]any {
@@ -44,6 +64,114 @@ func BuildJsonError(message string, hint string, trace any) map[string]any {
 	return m
 }
 
+// BuildJsonErrorCode builds {code: "error", error: message, error_code,
+// retryable, trace?} so orchestrators can decide whether to retry without
+// parsing the message. Pass nil trace to omit it.
+func BuildJsonErrorCode(message string, errorCode string, retryable bool, trace any) map[string]any {
+	m := map[string]any{
+		"code":       "error",
+		"error":      message,
+		"error_code": errorCode,
+		"retryable":  retryable,
+	}
+	if trace != nil {
+		m["trace"] = trace
+	}
+	return m
+}
+
+// BuildJsonErrors builds one error envelope for several failures:
+// {code: "error", error: "<first> (+N more)", errors, retryable: false,
+// trace?}, giving both a one-line summary and the full list. Pass nil trace
+// to omit it.
+func BuildJsonErrors(errors []string, trace any) map[string]any {
+	items := make([]any, len(errors))
+	for i, e := range errors {
+		items[i] = e
+	}
+	summary := ""
+	if len(errors) > 0 {
+		summary = errors[0]
+	}
+	if len(errors) > 1 {
+		summary += fmt.Sprintf(" (+%d more)", len(errors)-1)
+	}
+	m := map[string]any{
+		"code":      "error",
+		"error":     summary,
+		"errors":    items,
+		"retryable": false,
+	}
+	if trace != nil {
+		m["trace"] = trace
+	}
+	return m
+}
+
+// BuildJsonWarning builds {code: "warning", warning_code, warning: message,
+// retryable: false, trace?} for non-fatal conditions; agents may emit several
+// before the final ok. Pass nil trace to omit it.
+func BuildJsonWarning(message string, warningCode string, trace any) map[string]any {
+	m := map[string]any{
+		"code":         "warning",
+		"warning_code": warningCode,
+		"warning":      message,
+		"retryable":    false,
+	}
+	if trace != nil {
+		m["trace"] = trace
+	}
+	return m
+}
+
+// BuildJsonBatch builds one envelope for several sub-operation results:
+// {code: "batch", results, count, failed_count, trace?}. failed_count counts
+// results whose code is "error". Pass nil trace to omit it.
+func BuildJsonBatch(results []map[string]any, trace any) map[string]any {
+	items := make([]any, len(results))
+	failed := 0
+	for i, r := range results {
+		items[i] = r
+		if r["code"] == "error" {
+			failed++
+		}
+	}
+	m := map[string]any{
+		"code":         "batch",
+		"results":      items,
+		"count":        len(results),
+		"failed_count": failed,
+	}
+	if trace != nil {
+		m["trace"] = trace
+	}
+	return m
+}
+
+// BuildJsonOkLines is the newline-delimited form of a batch: each result is
+// wrapped with BuildJsonOk and rendered with OutputJson (redacted, single
+// line), one record per line with no trailing newline. For incremental
+// output use JsonArrayWriter.
+func BuildJsonOkLines(results []any) string {
+	lines := make([]string, len(results))
+	for i, r := range results {
+		lines[i] = OutputJson(BuildJsonOk(r, nil))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// BuildJsonCursor builds a cursor-paginated page
+// {code: "ok", result: items, next_cursor, has_next}. has_next is
+// nextCursor != ""; an empty cursor marks the end of the stream.
+func BuildJsonCursor(items any, nextCursor string) map[string]any {
+	return map[string]any{
+		"code":        "ok",
+		"result":      items,
+		"next_cursor": nextCursor,
+		"has_next":    nextCursor != "",
+	}
+}
+
 // BuildJson builds {code: "<custom>", ...fields, trace?}.
 func BuildJson(code string, fields any, trace any) map[string]any {
 	result := make(map[string]any)
@@ -59,6 +187,116 @@ func BuildJson(code string, fields any, trace any) map[string]any {
 	return result
 }
 
+// ValidateCode checks a protocol code against the naming convention: one or
+// more dot-separated segments, each starting with a lowercase letter followed
+// by lowercase letters, digits or '_' ("ok", "not_found", "request.start").
+func ValidateCode(code string) error {
+	if code == "" {
+		return fmt.Errorf("invalid code %q: empty", code)
+	}
+	for _, seg := range strings.Split(code, ".") {
+		if seg == "" {
+			return fmt.Errorf("invalid code %q: empty segment", code)
+		}
+		if seg[0] < 'a' || seg[0] > 'z' {
+			return fmt.Errorf("invalid code %q: segment %q must start with a lowercase letter", code, seg)
+		}
+		for _, c := range seg {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_') {
+				return fmt.Errorf("invalid code %q: unexpected character %q", code, c)
+			}
+		}
+	}
+	return nil
+}
+
+// BuildJsonStrict is BuildJson with the code checked by ValidateCode.
+func BuildJsonStrict(code string, fields any, trace any) (map[string]any, error) {
+	if err := ValidateCode(code); err != nil {
+		return nil, err
+	}
+	return BuildJson(code, fields, trace), nil
+}
+
+// BuildJsonStartup builds the startup diagnostic event
+// {code: "log", event: "startup", config, args, env}. Env values whose names
+// match RedactionOptions.EnvSecretSuffixes/EnvSecretSubstrings are replaced
+// with "***" in a copy, so OPENAI_API_KEY is masked even without a _secret
+// suffix. Other env vars are kept intact, a nil (unset) env value stays null,
+// and nil sections are omitted.
+func BuildJsonStartup(config any, args any, env map[string]any) map[string]any {
+	m := map[string]any{"code": "log", "event": "startup"}
+	if config != nil {
+		m["config"] = config
+	}
+	if args != nil {
+		m["args"] = args
+	}
+	if env != nil {
+		opts := currentRedactionOptions()
+		masked := make(map[string]any, len(env))
+		for k, v := range env {
+			if v != nil && isSecretEnvName(k, opts) {
+				v = "***"
+			}
+			masked[k] = v
+		}
+		m["env"] = masked
+	}
+	return m
+}
+
+func isSecretEnvName(name string, opts RedactionOptions) bool {
+	upper := strings.ToUpper(name)
+	for _, suffix := range opts.EnvSecretSuffixes {
+		if strings.HasSuffix(upper, strings.ToUpper(suffix)) {
+			return true
+		}
+	}
+	for _, sub := range opts.EnvSecretSubstrings {
+		if strings.Contains(upper, strings.ToUpper(sub)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Trace accumulates trace fields for a protocol payload:
+//
+//	t := afdata.NewTrace().Add("source", "db").Add("duration_ms", elapsed)
+//	afdata.BuildJsonOkTrace(result, t)
+//
+// Add overwrites an existing key. The zero value is ready to use.
+type Trace struct {
+	fields map[string]any
+}
+
+// NewTrace returns an empty Trace.
+func NewTrace() *Trace {
+	return &Trace{}
+}
+
+// Add sets key to value and returns t for chaining.
+func (t *Trace) Add(key string, value any) *Trace {
+	if t.fields == nil {
+		t.fields = make(map[string]any)
+	}
+	t.fields[key] = value
+	return t
+}
+
+// Map returns a copy of the trace fields, with duration_ms set to 0 when it
+// was not added (matching BuildCliError). Safe on a nil Trace.
+func (t *Trace) Map() map[string]any {
+	m := map[string]any{"duration_ms": 0}
+	if t != nil {
+		for k, v := range t.fields {
+			m[k] = v
+		}
+	}
+	return m
+}
+
 // ═══════════════════════════════════════════
 // Public API: Output Formatters
 // ═══════════════════════════════════════════
@@ -73,8 +311,14 @@ const (
 
 // OutputJson formats as single-line JSON. Secrets redacted, original keys, raw values.
 func OutputJson(value any) string {
+	return applyOutputHooks(OutputFormatJson, renderJSON(value))
+}
+
+// renderJSON is OutputJson without output hooks, for formats that fall back
+// to JSON and run the hooks under their own OutputFormat.
+func renderJSON(value any) string {
 	v := sanitizeForJSON(value)
-	redactSecrets(v)
+	redactAll(v)
 	return marshalOutputJSON(v)
 }
 
@@ -82,11 +326,78 @@ func OutputJson(value any) string {
 func OutputJsonWith(value any, redactionPolicy RedactionPolicy) string {
 	v := sanitizeForJSON(value)
 	applyRedactionPolicy(v, redactionPolicy)
-	return marshalOutputJSON(v)
+	return applyOutputHooks(OutputFormatJson, marshalOutputJSON(v))
+}
+
+// OutputJsonPretty formats as indented multi-line JSON for terminals.
+// It is OutputJson with whitespace added: same redaction, original keys,
+// raw values, JCS key order and the same string escaping.
+func OutputJsonPretty(value any) string {
+	v := sanitizeForJSON(value)
+	redactAll(v)
+	out := marshalOutputJSON(v)
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(out), "", "  "); err != nil {
+		return applyOutputHooks(OutputFormatJson, out)
+	}
+	return applyOutputHooks(OutputFormatJson, buf.String())
+}
+
+// OutputCompact formats as the smallest valid representation for embedding
+// in QR codes or URLs: OutputJson with no structural whitespace (spaces inside
+// string values are kept). Secrets redacted, original keys, raw values.
+func OutputCompact(value any) string {
+	return OutputCompactWith(value, nil)
+}
+
+// OutputCompactWith is OutputCompact with key shortening: keys found in
+// aliases are renamed at every depth after redaction (so _secret keys are
+// still detected). An alias that would collide with an existing key is skipped.
+func OutputCompactWith(value any, aliases map[string]string) string {
+	v := sanitizeForJSON(value)
+	redactAll(v)
+	if len(aliases) > 0 {
+		v = aliasKeys(v, aliases)
+	}
+	return applyOutputHooks(OutputFormatJson, marshalOutputJSON(v))
+}
+
+func aliasKeys(value any, aliases map[string]string) any {
+	switch v := value.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			out[k] = aliasKeys(item, aliases)
+		}
+		for _, k := range sortedKeys(v) {
+			alias, ok := aliases[k]
+			if !ok || alias == k {
+				continue
+			}
+			if _, taken := out[alias]; taken {
+				continue
+			}
+			out[alias] = out[k]
+			delete(out, k)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = aliasKeys(item, aliases)
+		}
+		return out
+	}
+	return value
 }
 
+// marshalOutputJSON encodes single-line JSON with object keys in JCS
+// (UTF-16 code unit) order, matching YAML/plain output. encoding/json sorts
+// by byte order, which differs for supplementary-plane characters.
 func marshalOutputJSON(value any) string {
-	out, err := json.Marshal(value)
+	var b strings.Builder
+	err := writeJSON(&b, value)
+	out := b.String()
 	if err != nil {
 		// Last-resort fallback: preserve JSONL contract even for pathological inputs.
 		fallback, _ := json.Marshal(map[string]any{
@@ -95,51 +406,345 @@ func marshalOutputJSON(value any) string {
 		})
 		return string(fallback)
 	}
-	return string(out)
+	return out
 }
 
 // OutputYaml formats as multi-line YAML. Keys stripped, values formatted, secrets redacted.
 func OutputYaml(value any) string {
 	lines := []string{"---"}
-	renderYamlProcessed(normalize(value), 0, &lines)
-	return strings.Join(lines, "\n")
+	renderYamlProcessed(prepareProcessed(value), 0, 1, &lines)
+	return applyOutputHooks(OutputFormatYaml, strings.Join(lines, "\n"))
+}
+
+// OutputYamlFlow formats as single-line flow-style YAML, e.g.
+// {latency: "150ms", name: "alice"}. Same key stripping, formatting and
+// redaction as OutputYaml; maps render as {...} and arrays as [...].
+func OutputYamlFlow(value any) string {
+	return applyOutputHooks(OutputFormatYaml, renderYamlFlow(prepareProcessed(value), 1))
 }
 
 // OutputPlain formats as single-line logfmt. Keys stripped, values formatted, secrets redacted.
 func OutputPlain(value any) string {
-	var pairs [][2]string
-	collectPlainPairs(normalize(value), "", &pairs)
+	return applyOutputHooks(OutputFormatPlain, renderPlain(value, false))
+}
+
+// ANSI codes used by OutputPlainColor.
+const (
+	ColorKey      = "\x1b[36m"   // cyan
+	ColorValue    = "\x1b[32m"   // green
+	ColorRedacted = "\x1b[2;31m" // dim red, for "***"
+	ColorReset    = "\x1b[0m"
+)
+
+// OutputPlainColor is OutputPlain with ANSI colors for terminals: keys in
+// ColorKey, values in ColorValue, redacted values in ColorRedacted. Order,
+// quoting and spacing are identical to OutputPlain, so stripping the escape
+// codes yields the plain line.
+func OutputPlainColor(value any) string {
+	return applyOutputHooks(OutputFormatPlain, renderPlain(value, true))
+}
+
+func renderPlain(value any, color bool) string {
+	var pairs []plainPair
+	collectPlainPairs(prepareProcessed(value), "", 1, &pairs)
 	sort.Slice(pairs, func(i, j int) bool {
-		return jcsLess(pairs[i][0], pairs[j][0])
+		return jcsLess(pairs[i].key, pairs[j].key)
 	})
 	parts := make([]string, len(pairs))
 	for i, p := range pairs {
-		if strings.Contains(p[1], " ") {
-			parts[i] = fmt.Sprintf("%s=\"%s\"", p[0], p[1])
-		} else {
-			parts[i] = fmt.Sprintf("%s=%s", p[0], p[1])
+		key, val := p.key, p.value
+		if !p.raw && strings.Contains(val, " ") {
+			val = "\"" + val + "\""
 		}
+		if color {
+			valueColor := ColorValue
+			if p.value == "***" {
+				valueColor = ColorRedacted
+			}
+			key = ColorKey + key + ColorReset
+			val = valueColor + val + ColorReset
+		}
+		parts[i] = key + "=" + val
 	}
 	return strings.Join(parts, " ")
 }
 
+// OutputCsv formats a flat result set ([]any of map[string]any with identical
+// keys) as CSV: a header row of stripped keys in JCS order, then one row per
+// element with values formatted and secrets redacted as in OutputPlain. Nested
+// maps flatten to dot-notation columns. Non-array or ragged input falls back to
+// a single OutputJson line.
+func OutputCsv(value any) string {
+	if out, ok := formatCsv(value); ok {
+		return applyOutputHooks(OutputFormatCsv, out)
+	}
+	return applyOutputHooks(OutputFormatCsv, renderJSON(value))
+}
+
+// OutputCsvStrict formats an array of objects as CSV like OutputCsv, but
+// tolerates ragged rows: the header is the union of all stripped keys in JCS
+// order and fields absent from a row become empty cells. Strict about the
+// shape instead: returns an error rather than falling back to JSON when
+// value is not an array of objects.
+func OutputCsvStrict(value any) (string, error) {
+	rows, err := csvPairs(value)
+	if err != nil {
+		return "", err
+	}
+	seen := map[string]bool{}
+	var header []string
+	for _, pairs := range rows {
+		for _, p := range pairs {
+			if !seen[p.key] {
+				seen[p.key] = true
+				header = append(header, p.key)
+			}
+		}
+	}
+	sort.Slice(header, func(i, j int) bool {
+		return jcsLess(header[i], header[j])
+	})
+	records := make([][]string, len(rows))
+	for i, pairs := range rows {
+		cells := make(map[string]string, len(pairs))
+		for _, p := range pairs {
+			cells[p.key] = p.value
+		}
+		record := make([]string, len(header))
+		for j, key := range header {
+			record[j] = cells[key]
+		}
+		records[i] = record
+	}
+	return applyOutputHooks(OutputFormatCsv, writeCsv(header, records)), nil
+}
+
+// formatCsv renders tabular input as CSV; ok is false for non-tabular input.
+func formatCsv(value any) (string, bool) {
+	rows, err := csvPairs(value)
+	if err != nil || len(rows) == 0 {
+		return "", false
+	}
+	var header []string
+	for _, p := range rows[0] {
+		header = append(header, p.key)
+	}
+	records := make([][]string, 0, len(rows))
+	for _, pairs := range rows {
+		if len(pairs) != len(header) {
+			return "", false
+		}
+		record := make([]string, len(pairs))
+		for j, p := range pairs {
+			if p.key != header[j] {
+				return "", false
+			}
+			record[j] = p.value
+		}
+		records = append(records, record)
+	}
+	return writeCsv(header, records), true
+}
+
+// csvPairs flattens each row of an array of objects into JCS-sorted pairs.
+func csvPairs(value any) ([][]plainPair, error) {
+	rows, ok := normalize(value).([]any)
+	if !ok {
+		return nil, fmt.Errorf("csv: expected an array of objects, got %T", value)
+	}
+	result := make([][]plainPair, len(rows))
+	for i, row := range rows {
+		m, ok := row.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("csv: row %d is not an object", i)
+		}
+		var pairs []plainPair
+		collectPlainPairs(prepareProcessed(m), "", 1, &pairs)
+		sort.Slice(pairs, func(i, j int) bool {
+			return jcsLess(pairs[i].key, pairs[j].key)
+		})
+		result[i] = pairs
+	}
+	return result, nil
+}
+
+func writeCsv(header []string, records [][]string) string {
+	var buf strings.Builder
+	w := csv.NewWriter(&buf)
+	w.Write(header)
+	w.WriteAll(records)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// RawString is a pre-formatted value that YAML and plain output emit verbatim:
+// no quoting, no escaping, no suffix formatting. JSON output encodes it as a
+// regular string. Redaction still applies when the key is a secret.
+type RawString string
+
+// ═══════════════════════════════════════════
+// Public API: Output Hooks
+// ═══════════════════════════════════════════
+
+// OutputHook transforms a fully formatted output string.
+type OutputHook func(format OutputFormat, s string) string
+
+var (
+	outputHooksMu sync.RWMutex
+	outputHooks   []OutputHook
+)
+
+// RegisterOutputHook adds a final transform applied after formatting in
+// every string formatter (OutputJson*, OutputCompact*, OutputYaml*,
+// OutputPlain*, OutputCsv*, OutputToml, OutputHtmlTable) and CliOutput.
+// The format is the one requested, even when CSV or TOML input falls back to
+// JSON. OutputMsgpack is binary and not hooked.
+// Hooks run in registration order. Use for org-specific sanitization that
+// suffix rules can't express (e.g. masking internal hostnames).
+func RegisterOutputHook(fn OutputHook) {
+	outputHooksMu.Lock()
+	defer outputHooksMu.Unlock()
+	outputHooks = append(outputHooks, fn)
+}
+
+func applyOutputHooks(format OutputFormat, s string) string {
+	outputHooksMu.RLock()
+	defer outputHooksMu.RUnlock()
+	for _, fn := range outputHooks {
+		s = fn(format, s)
+	}
+	return s
+}
+
 // ═══════════════════════════════════════════
 // Public API: Redaction & Utility
 // ═══════════════════════════════════════════
 
+var (
+	redactionPatterns []string
+	redactionReveal   int
+	redactionHashSalt []byte
+)
+
+// SetRedactionReveal makes redacted string secrets show their last n
+// characters after "***" (e.g. "***a1b2" for n=4) to help tell tokens apart
+// while debugging. Only strings of at least 3n characters are revealed;
+// shorter strings and non-string secrets stay "***". n <= 0 (default) reveals
+// nothing.
+func SetRedactionReveal(n int) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	redactionReveal = n
+}
+
+// SetRedactionHashSalt makes redacted string secrets render as a short
+// salted hash, "sha256:" plus the first 12 hex digits of
+// HMAC-SHA256(salt, value), so security teams can correlate the same secret
+// across lines without seeing it. The salt must come from the caller (keep
+// it private and stable for as long as hashes should match); an empty salt
+// (default) turns hashing off. Non-string secrets stay "***". Takes
+// precedence over SetRedactionReveal. The salt is copied.
+func SetRedactionHashSalt(salt []byte) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	redactionHashSalt = append([]byte(nil), salt...)
+}
+
+// maskSecret returns the redacted form of a secret value.
+func maskSecret(value any) string {
+	settingsMu.RLock()
+	n := redactionReveal
+	salt := redactionHashSalt
+	settingsMu.RUnlock()
+	s, ok := value.(string)
+	if ok && len(salt) > 0 {
+		mac := hmac.New(sha256.New, salt)
+		mac.Write([]byte(s))
+		return "sha256:" + hex.EncodeToString(mac.Sum(nil))[:12]
+	}
+	if !ok || n <= 0 {
+		return "***"
+	}
+	runes := []rune(s)
+	if len(runes) < 3*n {
+		return "***"
+	}
+	return "***" + string(runes[len(runes)-n:])
+}
+
+// SetRedactionPatterns sets extra key patterns redacted like _secret keys, in
+// every output format and at any depth: scalars become "***", containers are
+// traversed. Patterns are case-insensitive globs matched against the whole
+// key ("password", "*_token", "api_key*"). An empty list restores the default
+// suffix-only rule. Returns an error, leaving settings unchanged, for a
+// malformed pattern.
+func SetRedactionPatterns(patterns []string) error {
+	lowered := make([]string, len(patterns))
+	for i, p := range patterns {
+		p = strings.ToLower(p)
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid redaction pattern %q: %w", patterns[i], err)
+		}
+		lowered[i] = p
+	}
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	redactionPatterns = lowered
+	return nil
+}
+
+func currentRedactionPatterns() []string {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return redactionPatterns
+}
+
+// RedactValuesByRegexp replaces, in-place, every string in maps and arrays
+// that matches re with "***", whatever its key. A bare top-level string
+// cannot be modified in place. To apply a pattern to all output, add it to
+// RedactionOptions.ValuePatterns instead.
+func RedactValuesByRegexp(value any, re *regexp.Regexp) {
+	maskStringLeaves(value, re.MatchString)
+}
+
 // InternalRedactSecrets redacts _secret fields in-place.
 func InternalRedactSecrets(value any) {
 	redactSecrets(value)
 }
 
+// InternalRedactedCopy returns a deep copy of value with every redaction rule
+// OutputJson applies (_secret keys and RedactionOptions value rules). Leaves
+// keep their type for bridges to typed sinks such as OpenTelemetry: integer
+// kinds become int64 or uint64, floats float64, numbers inside structs
+// json.Number. The caller's value is never mutated.
+func InternalRedactedCopy(value any) any {
+	v := sanitizeWithVisited(value, map[visitKey]struct{}{}, sanitizeMsgpackLeaf)
+	redactAll(v)
+	return v
+}
+
 // ParseSize parses a human-readable size string into bytes.
-// Accepts bare numbers or numbers followed by a unit letter (B/K/M/G/T).
-// Case-insensitive. Trims whitespace. Returns (0, false) for invalid input.
+// Accepts bare numbers or numbers followed by a unit (B/K/M/G/T/P/E,
+// KB/MB/GB/TB/PB/EB or KiB/MiB/GiB/TiB/PiB/EiB, all binary), optionally
+// separated by whitespace ("10 MB"). Values past the uint64 range (16 EiB)
+// are rejected rather than wrapped.
+// Case-insensitive. Trims whitespace. Sizes are plain decimals: signs,
+// underscores and scientific notation ("1e3") are rejected. Returns
+// (0, false) for invalid input.
 func ParseSize(s string) (uint64, bool) {
 	s = strings.TrimSpace(s)
 	if s == "" {
 		return 0, false
 	}
+	// Two- and three-letter units: "10MB" and "10MiB" are "10M".
+	if n := len(s); n >= 2 && (s[n-1] == 'B' || s[n-1] == 'b') {
+		rest := s[:n-1]
+		if m := len(rest); m >= 2 && (rest[m-1] == 'i' || rest[m-1] == 'I') && strings.IndexByte("KMGTPEkmgtpe", rest[m-2]) >= 0 {
+			rest = rest[:m-1]
+		}
+		if strings.IndexByte("KMGTPEkmgtpe", rest[len(rest)-1]) >= 0 {
+			s = rest
+		}
+	}
 	last := s[len(s)-1]
 	var numStr string
 	var mult uint64
@@ -154,12 +759,17 @@ func ParseSize(s string) (uint64, bool) {
 		numStr, mult = s[:len(s)-1], 1024*1024*1024
 	case last == 'T' || last == 't':
 		numStr, mult = s[:len(s)-1], 1024*1024*1024*1024
+	case last == 'P' || last == 'p':
+		numStr, mult = s[:len(s)-1], 1<<50
+	case last == 'E' || last == 'e':
+		numStr, mult = s[:len(s)-1], 1<<60
 	case (last >= '0' && last <= '9') || last == '.':
 		numStr, mult = s, 1
 	default:
 		return 0, false
 	}
-	if numStr == "" {
+	numStr = strings.TrimRight(numStr, " \t")
+	if !isSizeNumber(numStr) {
 		return 0, false
 	}
 	if n, err := strconv.ParseUint(numStr, 10, 64); err == nil {
@@ -170,7 +780,7 @@ func ParseSize(s string) (uint64, bool) {
 		return lo, true
 	}
 	// Integer overflow must not silently fall back to float parsing.
-	if !strings.ContainsAny(numStr, ".eE") {
+	if !strings.Contains(numStr, ".") {
 		return 0, false
 	}
 	f, err := strconv.ParseFloat(numStr, 64)
@@ -184,31 +794,545 @@ func ParseSize(s string) (uint64, bool) {
 	return uint64(result), true
 }
 
+// isSizeNumber reports whether s is a plain decimal as ParseSize accepts
+// it: digits with an optional fractional part ("10", "1.5", ".5", "5.").
+// Signs, exponents, underscores and hex are rejected.
+func isSizeNumber(s string) bool {
+	digits, dot := 0, false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c >= '0' && c <= '9':
+			digits++
+		case c == '.' && !dot:
+			dot = true
+		default:
+			return false
+		}
+	}
+	return digits > 0
+}
+
+// ElapsedField injects m[outKey+"_ms"] = m[endKey] - m[startKey] so the span
+// formats through the _ms rules. Both epochs must be non-negative integers
+// with end >= start; otherwise m is left unchanged and false is returned.
+func ElapsedField(m map[string]any, startKey, endKey, outKey string) bool {
+	start, ok := asInt64(m[startKey])
+	if !ok || start < 0 {
+		return false
+	}
+	end, ok := asInt64(m[endKey])
+	if !ok || end < start {
+		return false
+	}
+	m[outKey+"_ms"] = end - start
+	return true
+}
+
+// FormatBytes renders a byte count exactly like the _bytes suffix (one
+// decimal, honoring SetBytesUnitMode): 5242880 → "5.0MB".
+func FormatBytes(bytes int64) string {
+	return formatBytesHuman(bytes)
+}
+
+// FormatBytesSI renders a byte count with base-1000 SI units regardless of
+// SetBytesUnitMode: 1500000 → "1.5MB", 1500 → "1.5kB".
+func FormatBytesSI(bytes int64) string {
+	return formatBytesScaled(bytes, 1000, siByteUnits)
+}
+
+// SatsPerBTC is the number of satoshis in one bitcoin.
+const SatsPerBTC = 100_000_000
+
+// SatsToBTC converts satoshis to bitcoin.
+func SatsToBTC(sats int64) float64 {
+	return float64(sats) / SatsPerBTC
+}
+
+// BTCToSats converts bitcoin to satoshis, rounding to the nearest satoshi.
+// Returns false for NaN, ±Inf, or amounts outside the int64 range.
+func BTCToSats(btc float64) (int64, bool) {
+	sats := math.Round(btc * SatsPerBTC)
+	if math.IsNaN(sats) || sats < math.MinInt64 || sats >= math.MaxInt64 {
+		return 0, false
+	}
+	return int64(sats), true
+}
+
+// MsatsToSats converts millisatoshis to satoshis, truncating toward zero.
+func MsatsToSats(msats int64) int64 {
+	return msats / 1000
+}
+
+// SatsToMsats converts satoshis to millisatoshis. Returns false on overflow.
+func SatsToMsats(sats int64) (int64, bool) {
+	if sats > math.MaxInt64/1000 || sats < math.MinInt64/1000 {
+		return 0, false
+	}
+	return sats * 1000, true
+}
+
+// FormatSats renders satoshis with thousands separators: 1234 → "1,234 sats".
+func FormatSats(n int64) string {
+	return formatSignedWithCommas(n) + " sats"
+}
+
+// currencySymbols are the symbols the built-in currency suffixes use.
+var currencySymbols = map[string]string{"USD": "$", "EUR": "\u20ac", "JPY": "\u00a5"}
+
+// FormatMoney renders an amount for the "amount + currency code" shape the
+// suffix rules can't express, with the decimals the currency uses and the
+// same digit grouping as the cents suffixes: USD "$1,234.50" (as
+// _usd_cents), EUR "€1,234.50", JPY "¥1,235" (no minor unit, as _jpy). Other
+// codes render like _{code}_cents: "1,234.50 GBP". Inject the result as an
+// already formatted field, e.g. m["price"] = FormatMoney(amount, currency).
+func FormatMoney(amount float64, code string) string {
+	code = strings.ToUpper(code)
+	decimals := 2
+	if code == "JPY" {
+		decimals = 0
+	}
+	scale := math.Pow10(decimals)
+	minor := math.Round(math.Abs(amount) * scale)
+	var num string
+	if math.IsNaN(minor) || minor >= math.MaxInt64 {
+		num = strconv.FormatFloat(math.Abs(amount), 'f', decimals, 64)
+	} else {
+		num = groupedAmount(uint64(minor), decimals)
+	}
+	sign := ""
+	if amount < 0 && minor != 0 {
+		sign = "-"
+	}
+	if symbol, ok := currencySymbols[code]; ok {
+		return sign + symbol + num
+	}
+	return sign + num + " " + code
+}
+
+// ═══════════════════════════════════════════
+// Public API: Custom Suffixes
+// ═══════════════════════════════════════════
+
+type customSuffix struct {
+	suffix string
+	fn     func(value any) (string, bool)
+}
+
+var (
+	customSuffixesMu sync.RWMutex
+	customSuffixes   []customSuffix
+)
+
+// RegisterSuffix registers a custom suffix formatter (e.g. "_tokens") for
+// YAML and plain output. Registered suffixes are checked before built-ins,
+// longest suffix first, and match exact lowercase or exact uppercase like
+// built-ins. A matching key is stripped and takes part in collision detection
+// exactly like built-ins. If fn returns false, matching continues with shorter
+// registered suffixes and then the built-in table. Re-registering a suffix
+// replaces its formatter. Intended to be called at init; safe for concurrent use.
+func RegisterSuffix(suffix string, fn func(value any) (string, bool)) {
+	suffix = strings.ToLower(suffix)
+	if !strings.HasPrefix(suffix, "_") {
+		suffix = "_" + suffix
+	}
+	customSuffixesMu.Lock()
+	defer customSuffixesMu.Unlock()
+	for i := range customSuffixes {
+		if customSuffixes[i].suffix == suffix {
+			customSuffixes[i].fn = fn
+			return
+		}
+	}
+	customSuffixes = append(customSuffixes, customSuffix{suffix, fn})
+	sort.SliceStable(customSuffixes, func(i, j int) bool {
+		return len(customSuffixes[i].suffix) > len(customSuffixes[j].suffix)
+	})
+}
+
+func tryCustomSuffix(key string, value any) (string, string, bool) {
+	customSuffixesMu.RLock()
+	defer customSuffixesMu.RUnlock()
+	for _, cs := range customSuffixes {
+		stripped, ok := stripSuffixCI(key, cs.suffix)
+		if !ok || stripped == "" {
+			continue
+		}
+		if formatted, ok := cs.fn(value); ok {
+			return stripped, formatted, true
+		}
+	}
+	return "", "", false
+}
+
+var (
+	valueLabelsMu sync.RWMutex
+	valueLabels   = map[string]map[any]string{}
+)
+
+// RegisterValueLabels labels the values of fields named key in YAML and plain
+// output: with {2: "running"}, status: 2 renders as "2 (running)". The key is
+// matched exactly at any depth and is not stripped; values without a label
+// render raw, and JSON output is unchanged. Numeric labels match any integral
+// form of the number (2, int64(2), 2.0, json.Number("2")). Labeled keys take
+// precedence over suffix processing. Passing nil or an empty map removes the
+// labels for key. Intended to be called at init; safe for concurrent use.
+func RegisterValueLabels(key string, labels map[any]string) {
+	valueLabelsMu.Lock()
+	defer valueLabelsMu.Unlock()
+	if len(labels) == 0 {
+		delete(valueLabels, key)
+		return
+	}
+	normalized := make(map[any]string, len(labels))
+	for v, label := range labels {
+		if k, ok := valueLabelKey(v); ok {
+			normalized[k] = label
+		}
+	}
+	valueLabels[key] = normalized
+}
+
+func tryValueLabel(key string, value any) (string, bool) {
+	valueLabelsMu.RLock()
+	defer valueLabelsMu.RUnlock()
+	labels, ok := valueLabels[key]
+	if !ok {
+		return "", false
+	}
+	k, ok := valueLabelKey(value)
+	if !ok {
+		return "", false
+	}
+	if label, ok := labels[k]; ok {
+		return plainScalar(value) + " (" + label + ")", true
+	}
+	return plainScalar(value), true
+}
+
+// valueLabelKey normalizes a scalar for label lookup: integral numbers become
+// int64, other numbers float64; strings and bools are kept as is.
+func valueLabelKey(value any) (any, bool) {
+	switch value.(type) {
+	case string, bool:
+		return value, true
+	}
+	if n, ok := asInt64(value); ok {
+		return n, true
+	}
+	if f, ok := asFloat64(value); ok {
+		return f, true
+	}
+	return nil, false
+}
+
+// ═══════════════════════════════════════════
+// Public API: Formatting Settings
+// ═══════════════════════════════════════════
+
+// Package-level formatting settings. Setters are meant to be called once at
+// init; reads are guarded so concurrent output stays race-free.
+var settingsMu sync.RWMutex
+
+// FormatConfig holds value-formatting options for YAML and plain output.
+// Start from DefaultFormatConfig and override fields as needed.
+type FormatConfig struct {
+	// Decimals rounds _percent, _ratio, _btc and second-converted _ms values to a
+	// fixed number of decimals. Negative keeps full precision (default).
+	Decimals int
+	// GroupSats adds thousands separators to integer _sats and _msats values
+	// ("1,234sats"). Default off.
+	GroupSats bool
+	// GuessTempUnit formats _temp values with a guessed unit marked uncertain
+	// ("37?°C"): -50..60 °C, above 60 up to 200 °F, 200..400 K. A best-effort
+	// debugging aid for sensor dumps with implied units. Default off.
+	GuessTempUnit bool
+	// CoerceNumericStrings lets numeric suffixes format quoted numbers from
+	// sloppy upstream JSON: size_bytes: "1024" → "1.0KB". Default off.
+	CoerceNumericStrings bool
+	// CurrencyConvert, when set, is consulted by the cents suffixes
+	// (_usd_cents, _eur_cents, _{code}_cents) with the uppercase currency
+	// code and amount; if it returns ok, the converted amount is appended for
+	// display: "$99.99 (≈€92.00)". Must be safe for concurrent use. Default nil.
+	CurrencyConvert func(code string, cents int64) (displayCode string, displayCents int64, ok bool)
+}
+
+// DefaultFormatConfig returns the default configuration (full precision).
+func DefaultFormatConfig() FormatConfig {
+	return FormatConfig{Decimals: -1}
+}
+
+var formatConfig = DefaultFormatConfig()
+
+// SetFormatConfig replaces the package-level formatting configuration.
+func SetFormatConfig(cfg FormatConfig) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	formatConfig = cfg
+}
+
+func currentFormatConfig() FormatConfig {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return formatConfig
+}
+
+// RedactionOptions holds opt-in redaction rules applied in addition to the
+// _secret suffix rule. Start from DefaultRedactionOptions.
+type RedactionOptions struct {
+	// RedactHighEntropy masks string values that look like credentials
+	// (only base64/hex token characters or a JWT, at least EntropyMinLength chars,
+	// Shannon entropy at or above EntropyThreshold bits/char) even without a
+	// _secret key. Aggressive defense in depth; off by default.
+	RedactHighEntropy bool
+	EntropyThreshold  float64
+	EntropyMinLength  int
+
+	// ValuePatterns masks string values matching any of these expressions
+	// (e.g. ^sk-[A-Za-z0-9]{20,} or a JWT shape) regardless of key, in all
+	// output formats.
+	ValuePatterns []*regexp.Regexp
+
+	// EnvSecretSuffixes and EnvSecretSubstrings mark env var names whose
+	// values BuildJsonStartup masks. Matching is case-insensitive.
+	EnvSecretSuffixes   []string
+	EnvSecretSubstrings []string
+}
+
+// DefaultRedactionOptions returns the defaults: entropy detection off,
+// threshold 4.0 bits/char, minimum length 20; env vars ending in _KEY,
+// _TOKEN or _SECRET, or containing PASSWORD, are masked at startup.
+func DefaultRedactionOptions() RedactionOptions {
+	return RedactionOptions{
+		EntropyThreshold:    4.0,
+		EntropyMinLength:    20,
+		EnvSecretSuffixes:   []string{"_KEY", "_TOKEN", "_SECRET"},
+		EnvSecretSubstrings: []string{"PASSWORD"},
+	}
+}
+
+var redactionOptions = DefaultRedactionOptions()
+
+// SetRedactionOptions replaces the package-level redaction options.
+func SetRedactionOptions(opts RedactionOptions) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	redactionOptions = opts
+}
+
+func currentRedactionOptions() RedactionOptions {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return redactionOptions
+}
+
+// BytesUnitMode selects the unit system used to render _bytes values.
+type BytesUnitMode int
+
+const (
+	// UnitDefault uses base-1024 with KB/MB/GB/TB labels (historical behavior).
+	UnitDefault BytesUnitMode = iota
+	// UnitIEC uses base-1024 with KiB/MiB/GiB/TiB labels.
+	UnitIEC
+	// UnitSI uses base-1000 with kB/MB/GB/TB labels.
+	UnitSI
+)
+
+var bytesUnitMode = UnitDefault
+
+// SetBytesUnitMode sets the unit system for _bytes formatting.
+func SetBytesUnitMode(mode BytesUnitMode) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	bytesUnitMode = mode
+}
+
+// ByteSliceMode selects how []byte values are rendered in all output formats.
+type ByteSliceMode int
+
+const (
+	// ByteSliceLength renders "<N bytes>" (default), keeping binary blobs out of output.
+	ByteSliceLength ByteSliceMode = iota
+	// ByteSliceBase64 renders standard base64 (encoding/json's default for []byte).
+	ByteSliceBase64
+	// ByteSliceHex renders lowercase hex.
+	ByteSliceHex
+)
+
+var byteSliceMode = ByteSliceLength
+
+// SetByteSliceMode sets how []byte values are rendered.
+func SetByteSliceMode(mode ByteSliceMode) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	byteSliceMode = mode
+}
+
+var maxFields int
+
+// SetMaxFields caps the number of fields YAML and plain output render per map
+// (at every nesting level). Maps wider than n render their first n fields in
+// JCS order plus "_omitted: <count>" ("_omitted_2" if the map has an
+// "_omitted" key). n <= 0 means unlimited (default).
+// JSON output is never truncated.
+func SetMaxFields(n int) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	maxFields = n
+}
+
+var maxDepth = 64
+
+// SetMaxDepth caps how deeply YAML and plain output descend into nested maps.
+// A map nested deeper than n renders as the marker "...": "truncated" instead
+// of its fields. Default 64; n <= 0 means unlimited. JSON output is never
+// truncated.
+func SetMaxDepth(n int) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	maxDepth = n
+}
+
+// depthExceeded reports whether a map at depth (1 = top level) is past the
+// SetMaxDepth limit.
+func depthExceeded(depth int) bool {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return maxDepth > 0 && depth > maxDepth
+}
+
+// DefaultTimestampLayout is the layout epoch suffixes render with by default:
+// millisecond-precision UTC RFC 3339.
+const DefaultTimestampLayout = "2006-01-02T15:04:05.000Z"
+
+var (
+	timestampLayout   = DefaultTimestampLayout
+	timestampLocation = time.UTC
+)
+
+// SetTimestampLayout sets the Go time layout and location used to render
+// _epoch_ms, _epoch_s and _epoch_ns values (e.g. time.RFC3339 for second
+// precision). Empty layout restores DefaultTimestampLayout; nil loc means UTC.
+// The default layout ends in a literal Z, so pair a non-UTC location with an
+// offset layout such as time.RFC3339.
+func SetTimestampLayout(layout string, loc *time.Location) {
+	if layout == "" {
+		layout = DefaultTimestampLayout
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	timestampLayout, timestampLocation = layout, loc
+}
+
+var phoneRegion string
+
+// SetPhoneRegion sets the default region for _e164 phone numbers. Numbers
+// belonging to the region render in national format (US: "+14155551234" →
+// "(415) 555-1234"); all others keep E.164. Supported: "US", "CA".
+// Empty string (default) keeps E.164 everywhere.
+func SetPhoneRegion(region string) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	phoneRegion = strings.ToUpper(region)
+}
+
+// Clock returns the current time. Override with SetClock for deterministic tests.
+type Clock func() time.Time
+
+var clock Clock = time.Now
+
+// SetClock replaces the clock used for every time the package reads itself:
+// timestamps of log records without a time and of handler summary lines.
+// nil restores time.Now.
+func SetClock(c Clock) {
+	if c == nil {
+		c = time.Now
+	}
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	clock = c
+}
+
+func now() time.Time {
+	settingsMu.RLock()
+	c := clock
+	settingsMu.RUnlock()
+	return c()
+}
+
 // ═══════════════════════════════════════════
 // Secret Redaction
 // ═══════════════════════════════════════════
 
+// redactNested returns a redacted copy of a container rendered as a single
+// scalar (e.g. maps inside arrays in plain output), which suffix processing
+// never reaches. Other values are returned unchanged.
+func redactNested(value any) any {
+	switch value.(type) {
+	case map[string]any, []any:
+		value = copyContainers(value)
+		redactSecrets(value)
+	}
+	return value
+}
+
 func redactSecrets(value any) {
+	redactSecretsWith(value, currentRedactionPatterns())
+}
+
+// redactSecretsWith redacts keys matching the _secret suffix rule or any of
+// the given SetRedactionPatterns globs.
+func redactSecretsWith(value any, patterns []string) {
 	switch v := value.(type) {
 	case map[string]any:
 		for k := range v {
-			if strings.HasSuffix(k, "_secret") || strings.HasSuffix(k, "_SECRET") {
+			if isMetadataKey(k) {
+				continue
+			}
+			if isSecretKey(k) || matchesRedactionPattern(k, patterns) {
 				switch v[k].(type) {
 				case map[string]any, []any:
 					// Traverse containers, don't replace
-					redactSecrets(v[k])
+					redactSecretsWith(v[k], patterns)
 				default:
-					v[k] = "***"
+					v[k] = maskSecret(v[k])
 				}
 			} else {
-				redactSecrets(v[k])
+				redactSecretsWith(v[k], patterns)
 			}
 		}
 	case []any:
 		for _, item := range v {
-			redactSecrets(item)
+			redactSecretsWith(item, patterns)
+		}
+	}
+}
+
+func matchesRedactionPattern(key string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return false
+	}
+	lower := strings.ToLower(key)
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, lower); ok {
+			return true
 		}
 	}
+	return false
+}
+
+// isSecretKey reports whether key ends in _secret or _SECRET.
+// Short keys and keys without '_' at the suffix boundary exit before any
+// string comparison, keeping secret-free data cheap to walk.
+func isSecretKey(key string) bool {
+	const n = len("_secret")
+	if len(key) < n || key[len(key)-n] != '_' {
+		return false
+	}
+	tail := key[len(key)-n+1:]
+	return tail == "secret" || tail == "SECRET"
 }
 
 func applyRedactionPolicy(value any, redactionPolicy RedactionPolicy) {
@@ -216,21 +1340,192 @@ func applyRedactionPolicy(value any, redactionPolicy RedactionPolicy) {
 	case RedactionTraceOnly:
 		if obj, ok := value.(map[string]any); ok {
 			if trace, exists := obj["trace"]; exists {
-				redactSecrets(trace)
+				redactAll(trace)
 			}
 		}
 	case RedactionNone:
 		// Explicitly disabled.
 	default:
 		// Safety fallback for unknown policy values.
-		redactSecrets(value)
+		redactAll(value)
+	}
+}
+
+// redactAll applies key-based and value-based redaction in-place.
+func redactAll(value any) {
+	redactSecrets(value)
+	redactValues(value)
+}
+
+// redactValues masks string leaves matched by value-based rules (e.g. high
+// entropy) in-place, regardless of key. No-op when no rule is enabled.
+func redactValues(value any) {
+	if match := valueRedactionMatcher(); match != nil {
+		maskStringLeaves(value, match)
+	}
+}
+
+// valueRedactionMatcher returns the active value-based rule, or nil.
+func valueRedactionMatcher() func(string) bool {
+	opts := currentRedactionOptions()
+	if !opts.RedactHighEntropy && len(opts.ValuePatterns) == 0 {
+		return nil
+	}
+	return func(s string) bool {
+		for _, re := range opts.ValuePatterns {
+			if re.MatchString(s) {
+				return true
+			}
+		}
+		return opts.RedactHighEntropy && isHighEntropy(s, opts)
+	}
+}
+
+// maskStringLeaves replaces matching string leaves of maps and arrays with "***" in-place.
+func maskStringLeaves(value any, match func(string) bool) {
+	switch v := value.(type) {
+	case map[string]any:
+		for k, item := range v {
+			if isMetadataKey(k) {
+				continue
+			}
+			if s, ok := leafString(item); ok {
+				if match(s) {
+					v[k] = "***"
+				}
+			} else {
+				maskStringLeaves(item, match)
+			}
+		}
+	case []any:
+		for i, item := range v {
+			if s, ok := leafString(item); ok {
+				if match(s) {
+					v[i] = "***"
+				}
+			} else {
+				maskStringLeaves(item, match)
+			}
+		}
+	}
+}
+
+func leafString(value any) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case RawString:
+		return string(v), true
+	}
+	return "", false
+}
+
+// isHighEntropy reports whether s looks like a credential: long enough,
+// made only of base64/base64url/hex token characters or shaped like a JWT
+// (so prose, paths and URLs never match), and Shannon entropy at or above
+// threshold.
+func isHighEntropy(s string, opts RedactionOptions) bool {
+	if len(s) < opts.EntropyMinLength || !isTokenAlphabet(s) && !isJWTShape(s) {
+		return false
+	}
+	return shannonEntropy(s) >= opts.EntropyThreshold
+}
+
+// isTokenAlphabet reports whether s uses only ASCII letters, digits and the
+// base64/base64url punctuation + / = - _.
+func isTokenAlphabet(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("+/=-_", c) >= 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// isJWTShape reports whether s is a compact JWS/JWT: three non-empty
+// token-alphabet segments joined by '.', the header starting with "eyJ"
+// (base64url of `{"`). The header check keeps dotted hostnames out.
+func isJWTShape(s string) bool {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 || !strings.HasPrefix(parts[0], "eyJ") {
+		return false
+	}
+	for _, p := range parts {
+		if p == "" || !isTokenAlphabet(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// shannonEntropy returns the Shannon entropy of s in bits per character.
+func shannonEntropy(s string) float64 {
+	counts := make(map[rune]int)
+	total := 0
+	for _, r := range s {
+		counts[r]++
+		total++
+	}
+	if total == 0 {
+		return 0
+	}
+	var h float64
+	for _, c := range counts {
+		p := float64(c) / float64(total)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// prepareProcessed normalizes a value for YAML/plain rendering and applies
+// value-based redaction on a copy, so caller data is never mutated.
+func prepareProcessed(value any) any {
+	v := normalize(value)
+	match := valueRedactionMatcher()
+	patterns := currentRedactionPatterns()
+	if match == nil && len(patterns) == 0 {
+		return v
+	}
+	v = copyContainers(v)
+	if len(patterns) > 0 {
+		redactSecretsWith(v, patterns)
+	}
+	if match != nil {
+		maskStringLeaves(v, match)
+	}
+	return v
+}
+
+// copyContainers deep-copies maps and arrays; other values are shared.
+func copyContainers(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			out[k] = copyContainers(item)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = copyContainers(item)
+		}
+		return out
 	}
+	return value
 }
 
 // ═══════════════════════════════════════════
 // Suffix Processing
 // ═══════════════════════════════════════════
 
+// isMetadataKey reports whether a key carries internal metadata (e.g. "__comment").
+// Metadata keys are dropped from every output format and skipped by redaction.
+func isMetadataKey(key string) bool {
+	return strings.HasPrefix(key, "__")
+}
+
 // stripSuffixCI strips a suffix matching exact lowercase or exact uppercase only.
 func stripSuffixCI(key, suffixLower string) (string, bool) {
 	if strings.HasSuffix(key, suffixLower) {
@@ -264,9 +1559,36 @@ type processedField struct {
 	isFormatted bool
 }
 
+// binaryUnitSuffixes are explicit power-of-1024 size suffixes. Values must
+// be integers; they are scaled to bytes and rendered like _bytes.
+var binaryUnitSuffixes = []struct {
+	suffix string
+	mult   int64
+}{
+	{"_kib", 1 << 10},
+	{"_mib", 1 << 20},
+	{"_gib", 1 << 30},
+	{"_tib", 1 << 40},
+}
+
 // tryProcessField tries suffix-driven processing.
 // Returns (stripped_key, formatted_value, true) or ("", "", false).
 func tryProcessField(key string, value any) (string, string, bool) {
+	// Registered value labels come first; the key is kept as is
+	if formatted, ok := tryValueLabel(key, value); ok {
+		return key, formatted, true
+	}
+
+	// Group 0: registered custom suffixes (longest first)
+	if stripped, formatted, ok := tryCustomSuffix(key, value); ok {
+		return stripped, formatted, true
+	}
+
+	// Group 0b: numeric suffixes with an inline precision digit (latency_ms2)
+	if stripped, formatted, ok := tryPrecisionSuffix(key, value); ok {
+		return stripped, formatted, true
+	}
+
 	// Group 1: compound timestamp suffixes
 	if stripped, ok := stripSuffixCI(key, "_epoch_ms"); ok {
 		if n, ok := asInt64(value); ok {
@@ -293,20 +1615,24 @@ func tryProcessField(key string, value any) (string, string, bool) {
 
 	// Group 2: compound currency suffixes
 	if stripped, ok := stripSuffixCI(key, "_usd_cents"); ok {
-		if n, ok := asNonNegInt64(value); ok {
-			return stripped, fmt.Sprintf("$%d.%02d", n/100, n%100), true
+		if n, ok := asInt64(value); ok {
+			sign, amount := formatCents(n)
+			return stripped, sign + "$" + amount + convertedCents("USD", n), true
 		}
 		return "", "", false
 	}
 	if stripped, ok := stripSuffixCI(key, "_eur_cents"); ok {
-		if n, ok := asNonNegInt64(value); ok {
-			return stripped, fmt.Sprintf("\u20ac%d.%02d", n/100, n%100), true
+		if n, ok := asInt64(value); ok {
+			sign, amount := formatCents(n)
+			return stripped, sign + "\u20ac" + amount + convertedCents("EUR", n), true
 		}
 		return "", "", false
 	}
 	if stripped, code, ok := tryStripGenericCents(key); ok {
-		if n, ok := asNonNegInt64(value); ok {
-			return stripped, fmt.Sprintf("%d.%02d %s", n/100, n%100, strings.ToUpper(code)), true
+		if n, ok := asInt64(value); ok {
+			sign, amount := formatCents(n)
+			code = strings.ToUpper(code)
+			return stripped, sign + amount + " " + code + convertedCents(code, n), true
 		}
 		return "", "", false
 	}
@@ -318,6 +1644,43 @@ func tryProcessField(key string, value any) (string, string, bool) {
 		}
 		return "", "", false
 	}
+	if stripped, ok := stripSuffixCI(key, "_e164"); ok {
+		if s, ok := value.(string); ok {
+			if formatted, ok := formatPhone(s); ok {
+				return stripped, formatted, true
+			}
+		}
+		return "", "", false
+	}
+	if stripped, ok := stripSuffixCI(key, "_base64"); ok {
+		if s, ok := value.(string); ok {
+			if decoded, ok := decodeBase64(s); ok {
+				if text, ok := printableText(decoded); ok {
+					return stripped, text, true
+				}
+				return stripped, s, true
+			}
+		}
+		return "", "", false
+	}
+	if stripped, ok := stripSuffixCI(key, "_hex"); ok {
+		if n, ok := asNonNegInt64(value); ok {
+			return stripped, "0x" + strconv.FormatInt(n, 16), true
+		}
+		return "", "", false
+	}
+	if stripped, ok := stripSuffixCI(key, "_rate_per_second"); ok {
+		if n, ok := asFloat64(value); ok {
+			return stripped, formatRate(n), true
+		}
+		return "", "", false
+	}
+	if stripped, ok := stripSuffixCI(key, "_rps"); ok {
+		if n, ok := asFloat64(value); ok {
+			return stripped, formatRate(n), true
+		}
+		return "", "", false
+	}
 	if stripped, ok := stripSuffixCI(key, "_minutes"); ok {
 		if _, ok := asFloat64(value); ok {
 			return stripped, plainScalar(value) + " minutes", true
@@ -337,16 +1700,41 @@ func tryProcessField(key string, value any) (string, string, bool) {
 		return "", "", false
 	}
 
+	if stripped, ok := stripSuffixCI(key, "_ghz"); ok {
+		if _, ok := asFloat64(value); ok {
+			return stripped, plainScalar(value) + " GHz", true
+		}
+		return "", "", false
+	}
+	if stripped, ok := stripSuffixCI(key, "_mhz"); ok {
+		if _, ok := asFloat64(value); ok {
+			return stripped, plainScalar(value) + " MHz", true
+		}
+		return "", "", false
+	}
+	if stripped, ok := stripSuffixCI(key, "_khz"); ok {
+		if _, ok := asFloat64(value); ok {
+			return stripped, plainScalar(value) + " kHz", true
+		}
+		return "", "", false
+	}
+	if stripped, ok := stripSuffixCI(key, "_hz"); ok {
+		if _, ok := asFloat64(value); ok {
+			return stripped, plainScalar(value) + " Hz", true
+		}
+		return "", "", false
+	}
+
 	// Group 4: single-unit suffixes
 	if stripped, ok := stripSuffixCI(key, "_msats"); ok {
 		if _, ok := asFloat64(value); ok {
-			return stripped, plainScalar(value) + "msats", true
+			return stripped, satsScalar(value) + "msats", true
 		}
 		return "", "", false
 	}
 	if stripped, ok := stripSuffixCI(key, "_sats"); ok {
 		if _, ok := asFloat64(value); ok {
-			return stripped, plainScalar(value) + "sats", true
+			return stripped, satsScalar(value) + "sats", true
 		}
 		return "", "", false
 	}
@@ -354,22 +1742,50 @@ func tryProcessField(key string, value any) (string, string, bool) {
 		if n, ok := asInt64(value); ok {
 			return stripped, formatBytesHuman(n), true
 		}
+		// Fractional byte counts (e.g. averages) round to the nearest byte.
+		if f, ok := asFloat64(value); ok {
+			if r := math.Round(f); r >= math.MinInt64 && r < math.MaxInt64 {
+				return stripped, formatBytesHuman(int64(r)), true
+			}
+		}
+		return "", "", false
+	}
+	for _, u := range binaryUnitSuffixes {
+		if stripped, ok := stripSuffixCI(key, u.suffix); ok {
+			if n, ok := asInt64(value); ok && n <= math.MaxInt64/u.mult && n >= math.MinInt64/u.mult {
+				return stripped, formatBytesHuman(n * u.mult), true
+			}
+			return "", "", false
+		}
+	}
+	if stripped, ok := stripSuffixCI(key, "_temp"); ok && currentFormatConfig().GuessTempUnit {
+		if n, ok := asFloat64(value); ok {
+			if unit, ok := guessTempUnit(n); ok {
+				return stripped, plainScalar(value) + "?" + unit, true
+			}
+		}
 		return "", "", false
 	}
 	if stripped, ok := stripSuffixCI(key, "_percent"); ok {
-		if _, ok := asFloat64(value); ok {
-			return stripped, plainScalar(value) + "%", true
+		if n, ok := asFloat64(value); ok {
+			return stripped, roundedScalar(value, n, -1) + "%", true
+		}
+		return "", "", false
+	}
+	if stripped, ok := stripSuffixCI(key, "_ratio"); ok {
+		if n, ok := asFloat64(value); ok {
+			return stripped, formatRatio(n, -1), true
 		}
 		return "", "", false
 	}
 	if stripped, ok := stripSuffixCI(key, "_secret"); ok {
-		return stripped, "***", true
+		return stripped, maskSecret(value), true
 	}
 
 	// Group 5: short suffixes (last to avoid false positives)
 	if stripped, ok := stripSuffixCI(key, "_btc"); ok {
-		if _, ok := asFloat64(value); ok {
-			return stripped, plainScalar(value) + " BTC", true
+		if n, ok := asFloat64(value); ok {
+			return stripped, roundedScalar(value, n, -1) + " BTC", true
 		}
 		return "", "", false
 	}
@@ -392,7 +1808,7 @@ func tryProcessField(key string, value any) (string, string, bool) {
 		return "", "", false
 	}
 	if stripped, ok := stripSuffixCI(key, "_ms"); ok {
-		if formatted, ok := formatMsValue(value); ok {
+		if formatted, ok := formatMsValue(value, -1); ok {
 			return stripped, formatted, true
 		}
 		return "", "", false
@@ -407,6 +1823,46 @@ func tryProcessField(key string, value any) (string, string, bool) {
 	return "", "", false
 }
 
+// precisionSuffixes accept one trailing digit giving the decimal places for
+// that field, overriding FormatConfig.Decimals: latency_ms2, cpu_percent1.
+var precisionSuffixes = []string{"_percent", "_ratio", "_btc", "_ms"}
+
+// tryPrecisionSuffix formats keys like "latency_ms2" (2 decimals). A numeric
+// suffix followed by a digit resolves to the same formatter as the bare
+// suffix, with the digit as the number of decimals.
+func tryPrecisionSuffix(key string, value any) (string, string, bool) {
+	if key == "" {
+		return "", "", false
+	}
+	last := key[len(key)-1]
+	if last < '0' || last > '9' {
+		return "", "", false
+	}
+	d := int(last - '0')
+	for _, suffix := range precisionSuffixes {
+		stripped, ok := stripSuffixCI(key[:len(key)-1], suffix)
+		if !ok {
+			continue
+		}
+		n, ok := asFloat64(value)
+		if !ok {
+			return "", "", false
+		}
+		switch suffix {
+		case "_percent":
+			return stripped, roundedScalar(value, n, d) + "%", true
+		case "_ratio":
+			return stripped, formatRatio(n, d), true
+		case "_btc":
+			return stripped, roundedScalar(value, n, d) + " BTC", true
+		default:
+			formatted, _ := formatMsValue(value, d)
+			return stripped, formatted, true
+		}
+	}
+	return "", "", false
+}
+
 // processObjectFields processes fields: strip keys, format values, detect collisions.
 func processObjectFields(m map[string]any) []processedField {
 	type entry struct {
@@ -419,6 +1875,9 @@ func processObjectFields(m map[string]any) []processedField {
 
 	entries := make([]entry, 0, len(m))
 	for k, v := range m {
+		if isMetadataKey(k) {
+			continue
+		}
 		if stripped, formatted, ok := tryProcessField(k, v); ok {
 			entries = append(entries, entry{stripped, k, v, formatted, true})
 		} else {
@@ -450,15 +1909,42 @@ func processObjectFields(m map[string]any) []processedField {
 	sort.Slice(result, func(i, j int) bool {
 		return jcsLess(result[i].key, result[j].key)
 	})
+
+	// Summarize very wide maps: keep the first n, report the rest
+	settingsMu.RLock()
+	limit := maxFields
+	settingsMu.RUnlock()
+	if limit > 0 && len(result) > limit {
+		omitted := len(result) - limit
+		result = append(result[:limit:limit], processedField{key: omittedKey(result), value: omitted})
+	}
 	return result
 }
 
+// omittedKey picks the key for the SetMaxFields count: "_omitted", or
+// "_omitted_2", "_omitted_3", ... when the map already has that key.
+func omittedKey(fields []processedField) string {
+	taken := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		taken[f.key] = true
+	}
+	key := "_omitted"
+	for i := 2; taken[key]; i++ {
+		key = "_omitted_" + strconv.Itoa(i)
+	}
+	return key
+}
+
 // ═══════════════════════════════════════════
 // Formatting Helpers
 // ═══════════════════════════════════════════
 
 // formatMsAsSeconds formats ms as seconds: 3 decimal places, trim trailing zeros, min 1 decimal.
-func formatMsAsSeconds(ms float64) string {
+// Non-negative decimals (or, when decimals < 0, FormatConfig.Decimals) renders exactly that many decimals instead.
+func formatMsAsSeconds(ms float64, decimals int) string {
+	if d := resolveDecimals(decimals); d >= 0 {
+		return strconv.FormatFloat(ms/1000, 'f', d, 64) + "s"
+	}
 	formatted := fmt.Sprintf("%.3f", ms/1000)
 	trimmed := strings.TrimRight(formatted, "0")
 	if strings.HasSuffix(trimmed, ".") {
@@ -468,17 +1954,121 @@ func formatMsAsSeconds(ms float64) string {
 }
 
 // formatMsValue formats _ms value: < 1000 → {n}ms, ≥ 1000 → seconds.
-func formatMsValue(value any) (string, bool) {
+// Non-negative decimals (a precision suffix like _ms2) rounds both forms;
+// otherwise only the seconds form follows FormatConfig.Decimals.
+func formatMsValue(value any, decimals int) (string, bool) {
 	n, ok := asFloat64(value)
 	if !ok {
 		return "", false
 	}
 	if math.Abs(n) >= 1000 {
-		return formatMsAsSeconds(n), true
+		return formatMsAsSeconds(n, decimals), true
+	}
+	if decimals >= 0 {
+		return strconv.FormatFloat(n, 'f', decimals, 64) + "ms", true
 	}
 	return plainScalar(value) + "ms", true
 }
 
+// formatByteSlice renders a []byte according to the configured ByteSliceMode.
+func formatByteSlice(b []byte) string {
+	settingsMu.RLock()
+	mode := byteSliceMode
+	settingsMu.RUnlock()
+	switch mode {
+	case ByteSliceBase64:
+		return base64.StdEncoding.EncodeToString(b)
+	case ByteSliceHex:
+		return hex.EncodeToString(b)
+	default:
+		return fmt.Sprintf("<%d bytes>", len(b))
+	}
+}
+
+// resolveDecimals returns decimals, or FormatConfig.Decimals when it is
+// negative (no per-field precision).
+func resolveDecimals(decimals int) int {
+	if decimals >= 0 {
+		return decimals
+	}
+	return currentFormatConfig().Decimals
+}
+
+// roundedScalar renders a numeric value with decimals places (falling back
+// to FormatConfig.Decimals), or via plainScalar at full precision when no
+// rounding is configured.
+func roundedScalar(value any, n float64, decimals int) string {
+	if d := resolveDecimals(decimals); d >= 0 {
+		return strconv.FormatFloat(n, 'f', d, 64)
+	}
+	return plainScalar(value)
+}
+
+// formatRatio renders a fraction as a percentage: 0.875 → "87.5%", 0.5 → "50%".
+// Rounds to 9 decimals and trims trailing zeros to absorb float noise
+// (0.07*100 = 7.000000000000001), unless decimals (falling back to
+// FormatConfig.Decimals) is non-negative.
+func formatRatio(n float64, decimals int) string {
+	pct := n * 100
+	if d := resolveDecimals(decimals); d >= 0 {
+		return strconv.FormatFloat(pct, 'f', d, 64) + "%"
+	}
+	s := strings.TrimRight(strconv.FormatFloat(pct, 'f', 9, 64), "0")
+	return strings.TrimSuffix(s, ".") + "%"
+}
+
+// decodeBase64 decodes standard or URL-safe base64 (padded or not).
+// Line breaks, which encoding/base64 would skip, make the value invalid.
+func decodeBase64(s string) ([]byte, bool) {
+	if s == "" || strings.ContainsAny(s, "\r\n") {
+		return nil, false
+	}
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if decoded, err := enc.DecodeString(s); err == nil {
+			return decoded, true
+		}
+	}
+	return nil, false
+}
+
+// printableText reports whether b is valid UTF-8 with no control characters
+// other than \n, \t and \r.
+func printableText(b []byte) (string, bool) {
+	if !utf8.Valid(b) {
+		return "", false
+	}
+	for _, r := range string(b) {
+		if unicode.IsControl(r) && r != '\n' && r != '\t' && r != '\r' {
+			return "", false
+		}
+	}
+	return string(b), true
+}
+
+// formatPhone validates an E.164 number and renders it for the configured region.
+func formatPhone(s string) (string, bool) {
+	if len(s) < 2 || len(s) > 16 || s[0] != '+' || s[1] == '0' {
+		return "", false
+	}
+	digits := s[1:]
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return "", false
+		}
+	}
+	settingsMu.RLock()
+	region := phoneRegion
+	settingsMu.RUnlock()
+	switch region {
+	case "US", "CA":
+		// NANP: +1 NPA NXX XXXX
+		if len(digits) == 11 && digits[0] == '1' {
+			return fmt.Sprintf("(%s) %s-%s", digits[1:4], digits[4:7], digits[7:]), true
+		}
+	}
+	return s, true
+}
+
 func formatRFC3339Ms(ms int64) string {
 	sec := ms / 1000
 	rem := ms % 1000
@@ -487,34 +2077,147 @@ func formatRFC3339Ms(ms int64) string {
 		rem += 1000
 	}
 	nsec := rem * 1_000_000
-	t := time.Unix(sec, nsec).UTC()
-	return t.Format("2006-01-02T15:04:05.000Z")
+	settingsMu.RLock()
+	layout, loc := timestampLayout, timestampLocation
+	settingsMu.RUnlock()
+	return time.Unix(sec, nsec).In(loc).Format(layout)
 }
 
 func formatBytesHuman(bytes int64) string {
-	const KB = 1024.0
-	const MB = KB * 1024
-	const GB = MB * 1024
-	const TB = GB * 1024
+	settingsMu.RLock()
+	mode := bytesUnitMode
+	settingsMu.RUnlock()
+	switch mode {
+	case UnitIEC:
+		return formatBytesScaled(bytes, 1024, []string{"KiB", "MiB", "GiB", "TiB", "PiB", "EiB"})
+	case UnitSI:
+		return formatBytesScaled(bytes, 1000, siByteUnits)
+	default:
+		return formatBytesScaled(bytes, 1024, []string{"KB", "MB", "GB", "TB", "PB", "EB"})
+	}
+}
+
+var siByteUnits = []string{"kB", "MB", "GB", "TB", "PB", "EB"}
 
+// formatBytesScaled renders bytes with one decimal in the largest unit whose
+// size (base^(i+1)) does not exceed the value; below base, renders "{n}B".
+func formatBytesScaled(bytes int64, base float64, units []string) string {
 	sign := ""
 	b := float64(bytes)
 	if b < 0 {
 		sign = "-"
 		b = -b
 	}
-	switch {
-	case b >= TB:
-		return fmt.Sprintf("%s%.1fTB", sign, b/TB)
-	case b >= GB:
-		return fmt.Sprintf("%s%.1fGB", sign, b/GB)
-	case b >= MB:
-		return fmt.Sprintf("%s%.1fMB", sign, b/MB)
-	case b >= KB:
-		return fmt.Sprintf("%s%.1fKB", sign, b/KB)
-	default:
+	if b < base {
 		return fmt.Sprintf("%dB", bytes)
 	}
+	i := 0
+	unit := base
+	for i < len(units)-1 && b >= unit*base {
+		unit *= base
+		i++
+	}
+	return fmt.Sprintf("%s%.1f%s", sign, b/unit, units[i])
+}
+
+// formatRate formats a per-second rate with base-1000 unit promotion and one
+// decimal: 950 → "950.0/s", 1523.4 → "1.5k/s", -2500000 → "-2.5M/s".
+func formatRate(n float64) string {
+	sign := ""
+	if n < 0 {
+		sign = "-"
+		n = -n
+	}
+	units := []string{"", "k", "M", "G", "T"}
+	i := 0
+	for i < len(units)-1 && math.Round(n*10)/10 >= 1000 {
+		n /= 1000
+		i++
+	}
+	if n == 0 {
+		sign = ""
+	}
+	return fmt.Sprintf("%s%.1f%s/s", sign, n, units[i])
+}
+
+// formatCents splits cents into a sign ("-" or "") and an unsigned grouped
+// amount ("1,234.56"), so the sign can sit outside the currency symbol.
+func formatCents(n int64) (string, string) {
+	sign := ""
+	mag := uint64(n)
+	if n < 0 {
+		sign = "-"
+		mag = uint64(-(n + 1)) + 1 // safe for math.MinInt64
+	}
+	return sign, groupedAmount(mag, 2)
+}
+
+// groupedAmount renders a count of minor units as a comma-grouped major
+// amount with the given decimals: groupedAmount(123456, 2) = "1,234.56".
+// FormatMoney and the cents suffixes share it so they group identically.
+func groupedAmount(minor uint64, decimals int) string {
+	unit := uint64(math.Pow10(decimals))
+	s := formatWithCommas(minor / unit)
+	if decimals > 0 {
+		s += fmt.Sprintf(".%0*d", decimals, minor%unit)
+	}
+	return s
+}
+
+// convertedCents returns the FormatConfig.CurrencyConvert display suffix for
+// a cents amount, " (≈€92.00)", or "" when no converter is set or it declines.
+func convertedCents(code string, n int64) string {
+	convert := currentFormatConfig().CurrencyConvert
+	if convert == nil {
+		return ""
+	}
+	displayCode, displayCents, ok := convert(code, n)
+	if !ok {
+		return ""
+	}
+	displayCode = strings.ToUpper(displayCode)
+	sign, amount := formatCents(displayCents)
+	switch displayCode {
+	case "USD":
+		return " (\u2248" + sign + "$" + amount + ")"
+	case "EUR":
+		return " (\u2248" + sign + "\u20ac" + amount + ")"
+	default:
+		return " (\u2248" + sign + amount + " " + displayCode + ")"
+	}
+}
+
+// guessTempUnit picks a likely temperature unit from magnitude alone. Values
+// outside every band are left unformatted.
+func guessTempUnit(n float64) (string, bool) {
+	switch {
+	case n >= -50 && n <= 60:
+		return "\u00b0C", true
+	case n > 60 && n < 200:
+		return "\u00b0F", true
+	case n >= 200 && n <= 400:
+		return "K", true
+	}
+	return "", false
+}
+
+// satsScalar renders a sats/msats amount, grouped when FormatConfig.GroupSats
+// is set and the value is an integer.
+func satsScalar(value any) string {
+	if currentFormatConfig().GroupSats {
+		if n, ok := asInt64(value); ok {
+			return formatSignedWithCommas(n)
+		}
+	}
+	return plainScalar(value)
+}
+
+// formatSignedWithCommas groups digits of a signed integer; safe for math.MinInt64.
+func formatSignedWithCommas(n int64) string {
+	if n < 0 {
+		return "-" + formatWithCommas(uint64(-(n+1))+1)
+	}
+	return formatWithCommas(uint64(n))
 }
 
 func formatWithCommas(n uint64) string {
@@ -557,45 +2260,135 @@ func extractCurrencyCode(key string) string {
 // YAML Rendering
 // ═══════════════════════════════════════════
 
-func renderYamlProcessed(value any, indent int, lines *[]string) {
+func renderYamlProcessed(value any, indent int, depth int, lines *[]string) {
 	prefix := strings.Repeat("  ", indent)
+	if items, ok := value.([]any); ok {
+		renderYamlSequence(items, indent, depth, lines)
+		return
+	}
 	m, ok := value.(map[string]any)
 	if !ok {
 		*lines = append(*lines, fmt.Sprintf("%s%s", prefix, yamlScalar(value)))
 		return
 	}
+	if depthExceeded(depth) {
+		*lines = append(*lines, prefix+`"...": "truncated"`)
+		return
+	}
 
 	for _, pf := range processObjectFields(m) {
 		if pf.isFormatted {
-			*lines = append(*lines, fmt.Sprintf("%s%s: \"%s\"", prefix, pf.key, escapeYamlStr(pf.formatted)))
+			*lines = append(*lines, fmt.Sprintf("%s%s: \"%s\"", prefix, yamlKey(pf.key), escapeYamlStr(pf.formatted)))
 		} else {
 			switch v := pf.value.(type) {
 			case map[string]any:
 				if len(v) > 0 {
-					*lines = append(*lines, fmt.Sprintf("%s%s:", prefix, pf.key))
-					renderYamlProcessed(v, indent+1, lines)
+					*lines = append(*lines, fmt.Sprintf("%s%s:", prefix, yamlKey(pf.key)))
+					renderYamlProcessed(v, indent+1, depth+1, lines)
 				} else {
-					*lines = append(*lines, fmt.Sprintf("%s%s: {}", prefix, pf.key))
+					*lines = append(*lines, fmt.Sprintf("%s%s: {}", prefix, yamlKey(pf.key)))
 				}
 			case []any:
 				if len(v) == 0 {
-					*lines = append(*lines, fmt.Sprintf("%s%s: []", prefix, pf.key))
+					*lines = append(*lines, fmt.Sprintf("%s%s: []", prefix, yamlKey(pf.key)))
 				} else {
-					*lines = append(*lines, fmt.Sprintf("%s%s:", prefix, pf.key))
-					for _, item := range v {
-						if _, ok := item.(map[string]any); ok {
-							*lines = append(*lines, fmt.Sprintf("%s  -", prefix))
-							renderYamlProcessed(item, indent+2, lines)
-						} else {
-							*lines = append(*lines, fmt.Sprintf("%s  - %s", prefix, yamlScalar(item)))
-						}
-					}
+					*lines = append(*lines, fmt.Sprintf("%s%s:", prefix, yamlKey(pf.key)))
+					renderYamlSequence(v, indent+1, depth, lines)
 				}
 			default:
-				*lines = append(*lines, fmt.Sprintf("%s%s: %s", prefix, pf.key, yamlScalar(pf.value)))
+				*lines = append(*lines, fmt.Sprintf("%s%s: %s", prefix, yamlKey(pf.key), yamlScalar(pf.value)))
+			}
+		}
+	}
+}
+
+// renderYamlSequence renders an array as "- item" lines. Non-empty object
+// and array elements go on their own "-" line followed by an indented block;
+// object elements get suffix processing like any nested map.
+func renderYamlSequence(items []any, indent int, depth int, lines *[]string) {
+	prefix := strings.Repeat("  ", indent)
+	if len(items) == 0 {
+		*lines = append(*lines, prefix+"[]")
+		return
+	}
+	for _, item := range items {
+		switch v := item.(type) {
+		case map[string]any:
+			if len(v) == 0 {
+				*lines = append(*lines, prefix+"- {}")
+				continue
+			}
+			*lines = append(*lines, prefix+"-")
+			renderYamlProcessed(v, indent+1, depth+1, lines)
+		case []any:
+			if len(v) == 0 {
+				*lines = append(*lines, prefix+"- []")
+				continue
+			}
+			*lines = append(*lines, prefix+"-")
+			renderYamlSequence(v, indent+1, depth+1, lines)
+		default:
+			*lines = append(*lines, fmt.Sprintf("%s- %s", prefix, yamlScalar(redactNested(item))))
+		}
+	}
+}
+
+func renderYamlFlow(value any, depth int) string {
+	switch v := value.(type) {
+	case map[string]any:
+		if depthExceeded(depth) {
+			return `{"...": "truncated"}`
+		}
+		fields := processObjectFields(v)
+		parts := make([]string, len(fields))
+		for i, pf := range fields {
+			if pf.isFormatted {
+				parts[i] = fmt.Sprintf("%s: \"%s\"", yamlKey(pf.key), escapeYamlStr(pf.formatted))
+			} else {
+				parts[i] = fmt.Sprintf("%s: %s", yamlKey(pf.key), renderYamlFlow(pf.value, depth+1))
 			}
 		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	case []any:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = renderYamlFlow(item, depth+1)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case RawString:
+		// Verbatim output must not break the single-line guarantee.
+		if strings.ContainsAny(string(v), "\r\n") {
+			return yamlScalar(string(v))
+		}
+	}
+	return yamlScalar(value)
+}
+
+// yamlKey quotes keys a YAML 1.1 or 1.2 parser would not read back as the
+// same plain string: empty keys, bool/null-like tokens (on, yes, ~, ...),
+// number-like keys, keys starting with an indicator character, and keys
+// containing a flow indicator (,[]{}), ": " or " #" anywhere, since a flow
+// indicator ends a plain key inside OutputYamlFlow's {...}.
+func yamlKey(key string) string {
+	if needsYamlKeyQuote(key) {
+		return `"` + escapeYamlStr(key) + `"`
+	}
+	return key
+}
+
+func needsYamlKeyQuote(key string) bool {
+	if key == "" || strings.TrimSpace(key) != key {
+		return true
 	}
+	switch strings.ToLower(key) {
+	case "y", "n", "yes", "no", "on", "off", "true", "false", "null", "~":
+		return true
+	}
+	if c := key[0]; c >= '0' && c <= '9' || strings.IndexByte("-?:,[]{}#&*!|>'\"%@`+.", c) >= 0 {
+		return true
+	}
+	return strings.HasSuffix(key, ":") || strings.Contains(key, ": ") || strings.Contains(key, " #") ||
+		strings.ContainsAny(key, ",[]{}\n\r\t")
 }
 
 func escapeYamlStr(s string) string {
@@ -611,6 +2404,10 @@ func yamlScalar(value any) string {
 	switch v := value.(type) {
 	case string:
 		return fmt.Sprintf(`"%s"`, escapeYamlStr(v))
+	case RawString:
+		return string(v)
+	case []byte:
+		return fmt.Sprintf(`"%s"`, formatByteSlice(v))
 	case nil:
 		return "null"
 	case bool:
@@ -623,10 +2420,7 @@ func yamlScalar(value any) string {
 	case int64:
 		return strconv.FormatInt(v, 10)
 	case float64:
-		if v == math.Trunc(v) && !math.IsInf(v, 0) && math.Abs(v) < 1e15 {
-			return fmt.Sprintf("%.0f", v)
-		}
-		return strconv.FormatFloat(v, 'f', -1, 64)
+		return formatFloatJSON(v)
 	case json.Number:
 		return v.String()
 	default:
@@ -634,36 +2428,75 @@ func yamlScalar(value any) string {
 	}
 }
 
+// formatFloatJSON formats a float exactly as encoding/json does (ES6 number
+// formatting), so a value looks identical across JSON, YAML and plain output.
+// NaN and ±Inf, which JSON cannot encode, render via strconv.
+func formatFloatJSON(f float64) string {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	b := strconv.AppendFloat(nil, f, format, -1, 64)
+	if format == 'e' {
+		// Clean up e-09 to e-9, matching encoding/json.
+		n := len(b)
+		if n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	return string(b)
+}
+
 // ═══════════════════════════════════════════
 // Plain Rendering (logfmt)
 // ═══════════════════════════════════════════
 
-func collectPlainPairs(value any, prefix string, pairs *[][2]string) {
+type plainPair struct {
+	key   string
+	value string
+	raw   bool
+}
+
+func collectPlainPairs(value any, prefix string, depth int, pairs *[]plainPair) {
 	m, ok := value.(map[string]any)
 	if !ok {
 		return
 	}
+	if depthExceeded(depth) {
+		key := "..."
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		*pairs = append(*pairs, plainPair{key: key, value: "truncated"})
+		return
+	}
 	for _, pf := range processObjectFields(m) {
 		fullKey := pf.key
 		if prefix != "" {
 			fullKey = prefix + "." + pf.key
 		}
 		if pf.isFormatted {
-			*pairs = append(*pairs, [2]string{fullKey, pf.formatted})
+			*pairs = append(*pairs, plainPair{key: fullKey, value: pf.formatted})
 		} else {
 			switch v := pf.value.(type) {
 			case map[string]any:
-				collectPlainPairs(v, fullKey, pairs)
+				collectPlainPairs(v, fullKey, depth+1, pairs)
 			case []any:
 				parts := make([]string, len(v))
 				for i, item := range v {
-					parts[i] = plainScalar(item)
+					parts[i] = plainScalar(redactNested(item))
 				}
-				*pairs = append(*pairs, [2]string{fullKey, strings.Join(parts, ",")})
+				*pairs = append(*pairs, plainPair{key: fullKey, value: strings.Join(parts, ",")})
 			case nil:
-				*pairs = append(*pairs, [2]string{fullKey, ""})
+				*pairs = append(*pairs, plainPair{key: fullKey})
+			case RawString:
+				*pairs = append(*pairs, plainPair{key: fullKey, value: string(v), raw: true})
 			default:
-				*pairs = append(*pairs, [2]string{fullKey, plainScalar(pf.value)})
+				*pairs = append(*pairs, plainPair{key: fullKey, value: plainScalar(pf.value)})
 			}
 		}
 	}
@@ -673,6 +2506,10 @@ func plainScalar(value any) string {
 	switch v := value.(type) {
 	case string:
 		return v
+	case RawString:
+		return string(v)
+	case []byte:
+		return formatByteSlice(v)
 	case nil:
 		return "null"
 	case bool:
@@ -685,10 +2522,7 @@ func plainScalar(value any) string {
 	case int64:
 		return strconv.FormatInt(v, 10)
 	case float64:
-		if v == math.Trunc(v) && !math.IsInf(v, 0) && math.Abs(v) < 1e15 {
-			return fmt.Sprintf("%.0f", v)
-		}
-		return strconv.FormatFloat(v, 'f', -1, 64)
+		return formatFloatJSON(v)
 	case json.Number:
 		return v.String()
 	default:
@@ -700,6 +2534,10 @@ func plainScalar(value any) string {
 // Utilities
 // ═══════════════════════════════════════════
 
+// asInt64 converts integral numerics to int64.
+// json.Number prefers exact int64 parsing; integral non-int forms ("1536.0",
+// "1.5e3") are accepted only when the float parse is lossless and within
+// int64 range. Overflow (e.g. 9223372036854775808) returns false.
 func asInt64(value any) (int64, bool) {
 	switch v := value.(type) {
 	case int:
@@ -707,13 +2545,23 @@ func asInt64(value any) (int64, bool) {
 	case int64:
 		return v, true
 	case float64:
-		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+		if v == math.Trunc(v) && v >= math.MinInt64 && v < math.MaxInt64 {
 			return int64(v), true
 		}
+	case string:
+		if n, ok := coercedNumber(v); ok {
+			return asInt64(n)
+		}
 	case json.Number:
 		if n, err := v.Int64(); err == nil {
 			return n, true
 		}
+		if strings.ContainsAny(v.String(), ".eE") {
+			f, exact, ok := jsonNumberFloat64(v)
+			if ok && exact && f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+				return int64(f), true
+			}
+		}
 	}
 	return 0, false
 }
@@ -726,6 +2574,9 @@ func asNonNegInt64(value any) (int64, bool) {
 	return 0, false
 }
 
+// asFloat64 converts numerics to float64.
+// json.Number values beyond float64 range return false; values that parse with
+// precision loss (see jsonNumberFloat64) are accepted as the nearest float.
 func asFloat64(value any) (float64, bool) {
 	switch v := value.(type) {
 	case int:
@@ -734,19 +2585,49 @@ func asFloat64(value any) (float64, bool) {
 		return float64(v), true
 	case float64:
 		return v, true
-	case json.Number:
-		if n, err := v.Float64(); err == nil {
-			return n, true
+	case string:
+		if n, ok := coercedNumber(v); ok {
+			return asFloat64(n)
 		}
+	case json.Number:
+		f, _, ok := jsonNumberFloat64(v)
+		return f, ok
 	}
 	return 0, false
 }
 
+// coercedNumber reads a quoted number ("42", "-1.5") as json.Number when
+// FormatConfig.CoerceNumericStrings is set.
+func coercedNumber(s string) (json.Number, bool) {
+	if !currentFormatConfig().CoerceNumericStrings || !isPlainNumber(s) {
+		return "", false
+	}
+	if _, err := strconv.ParseFloat(s, 64); err != nil {
+		return "", false
+	}
+	return json.Number(s), true
+}
+
+// jsonNumberFloat64 parses a json.Number as float64. exact reports whether
+// the float's shortest decimal form equals the input value, i.e. no precision
+// was lost (false for 9223372036854775809 or "0.1000000000000000000001").
+func jsonNumberFloat64(n json.Number) (f float64, exact bool, ok bool) {
+	f, err := strconv.ParseFloat(n.String(), 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0, false, false
+	}
+	want, okWant := new(big.Rat).SetString(n.String())
+	got, okGot := new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, 64))
+	return f, okWant && okGot && want.Cmp(got) == 0, true
+}
+
 // normalize converts a Go value through JSON round-trip to get map[string]any.
 func normalize(value any) any {
-	switch value.(type) {
+	switch v := value.(type) {
 	case map[string]any, []any, string, float64, bool, nil, json.Number:
 		return value
+	case []byte:
+		return formatByteSlice(v)
 	}
 	b, err := json.Marshal(value)
 	if err != nil {
@@ -761,7 +2642,7 @@ func normalize(value any) any {
 
 // sanitizeForJSON converts values into JSON-safe data while preserving map/array structure.
 func sanitizeForJSON(value any) any {
-	return sanitizeForJSONWithVisited(value, map[visitKey]struct{}{})
+	return sanitizeWithVisited(value, map[visitKey]struct{}{}, sanitizeJSONLeaf)
 }
 
 type visitKey struct {
@@ -769,7 +2650,9 @@ type visitKey struct {
 	ptr  uintptr
 }
 
-func sanitizeForJSONWithVisited(value any, visited map[visitKey]struct{}) any {
+// sanitizeWithVisited copies map[string]any/[]any structure, dropping
+// metadata keys and breaking cycles, and converts every other value with leaf.
+func sanitizeWithVisited(value any, visited map[visitKey]struct{}, leaf func(any) any) any {
 	switch v := value.(type) {
 	case map[string]any:
 		rv := reflect.ValueOf(v)
@@ -784,7 +2667,10 @@ func sanitizeForJSONWithVisited(value any, visited map[visitKey]struct{}) any {
 
 		out := make(map[string]any, len(v))
 		for k, item := range v {
-			out[k] = sanitizeForJSONWithVisited(item, visited)
+			if isMetadataKey(k) {
+				continue
+			}
+			out[k] = sanitizeWithVisited(item, visited, leaf)
 		}
 		return out
 	case []any:
@@ -800,11 +2686,14 @@ func sanitizeForJSONWithVisited(value any, visited map[visitKey]struct{}) any {
 
 		out := make([]any, len(v))
 		for i, item := range v {
-			out[i] = sanitizeForJSONWithVisited(item, visited)
+			out[i] = sanitizeWithVisited(item, visited, leaf)
 		}
 		return out
 	}
+	return leaf(value)
+}
 
+func sanitizeJSONLeaf(value any) any {
 	normalized := normalize(value)
 	if _, err := json.Marshal(normalized); err == nil {
 		return normalized
@@ -813,6 +2702,101 @@ func sanitizeForJSONWithVisited(value any, visited map[visitKey]struct{}) any {
 	return fmt.Sprintf("<unsupported:%T>", value)
 }
 
+func writeJSON(b *strings.Builder, value any) error {
+	switch v := value.(type) {
+	case map[string]any:
+		b.WriteByte('{')
+		for i, k := range sortedKeys(v) {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeJSONString(b, k)
+			b.WriteByte(':')
+			if err := writeJSON(b, v[k]); err != nil {
+				return err
+			}
+		}
+		b.WriteByte('}')
+	case []any:
+		b.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if err := writeJSON(b, item); err != nil {
+				return err
+			}
+		}
+		b.WriteByte(']')
+	case string:
+		writeJSONString(b, v)
+	default:
+		out, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		b.Write(out)
+	}
+	return nil
+}
+
+// writeJSONString writes s as a JSON string the way json.Marshal does: quotes,
+// backslashes and control characters escaped, <, > and & escaped as \u003c,
+// \u003e and \u0026 (safe to embed in HTML), U+2028 and U+2029 escaped, and
+// invalid UTF-8 replaced with U+FFFD.
+func writeJSONString(b *strings.Builder, s string) {
+	const hex = "0123456789abcdef"
+	b.WriteByte('"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				b.WriteByte('\\')
+				b.WriteByte(c)
+			case c == '\n':
+				b.WriteString(`\n`)
+			case c == '\r':
+				b.WriteString(`\r`)
+			case c == '\t':
+				b.WriteString(`\t`)
+			case c < 0x20 || c == '<' || c == '>' || c == '&':
+				b.WriteString(`\u00`)
+				b.WriteByte(hex[c>>4])
+				b.WriteByte(hex[c&0xf])
+			default:
+				b.WriteByte(c)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			b.WriteString(`\ufffd`)
+		case r == '\u2028' || r == '\u2029':
+			b.WriteString(`\u202`)
+			b.WriteByte(hex[r&0xf])
+		default:
+			b.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	b.WriteByte('"')
+}
+
+// sortedKeys returns the keys of m in JCS order.
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return jcsLess(keys[i], keys[j])
+	})
+	return keys
+}
+
 // jcsLess compares two strings by UTF-16 code unit order per RFC 8785.
 func jcsLess(a, b string) bool {
 	ua := utf16.Encode([]rune(a))
@@ -0,0 +1,70 @@
+package afdata
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+)
+
+// ═══════════════════════════════════════════
+// Public API: Capture Handler (for tests)
+// ═══════════════════════════════════════════
+
+// CaptureHandler is a slog.Handler for tests of code that logs. Instead of
+// writing lines it stores each record's field map exactly as AfdataHandler
+// builds it (timestamp_epoch_ms, message, code, span and event fields), so
+// tests can assert on fields without parsing output. Span fields attached via
+// WithAttrs are included and redacted as in AfdataHandler; event fields are
+// stored unredacted. All levels are captured.
+type CaptureHandler struct {
+	inner *AfdataHandler
+	state *captureState
+}
+
+// captureState is shared by all handlers derived via WithAttrs.
+type captureState struct {
+	mu      sync.Mutex
+	records []map[string]any
+}
+
+// NewCaptureHandler creates an empty CaptureHandler.
+func NewCaptureHandler() *CaptureHandler {
+	return &CaptureHandler{
+		inner: NewAfdataHandler(io.Discard, FormatJson),
+		state: &captureState{},
+	}
+}
+
+// Enabled always returns true: every level is captured.
+func (h *CaptureHandler) Enabled(_ context.Context, _ slog.Level) bool {
+	return true
+}
+
+// Handle stores the record's field map.
+func (h *CaptureHandler) Handle(ctx context.Context, r slog.Record) error {
+	m := h.inner.buildRecord(ctx, r)
+	h.state.mu.Lock()
+	defer h.state.mu.Unlock()
+	h.state.records = append(h.state.records, m)
+	return nil
+}
+
+// WithAttrs returns a handler with additional span-level fields that stores
+// into the same record list.
+func (h *CaptureHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &CaptureHandler{inner: h.inner.WithAttrs(attrs).(*AfdataHandler), state: h.state}
+}
+
+// WithGroup returns a handler that nests later fields under name, as
+// AfdataHandler.WithGroup does, and stores into the same record list.
+func (h *CaptureHandler) WithGroup(name string) slog.Handler {
+	return &CaptureHandler{inner: h.inner.WithGroup(name).(*AfdataHandler), state: h.state}
+}
+
+// Records returns the captured field maps in logging order.
+func (h *CaptureHandler) Records() []map[string]any {
+	h.state.mu.Lock()
+	defer h.state.mu.Unlock()
+	return append([]map[string]any(nil), h.state.records...)
+}
@@ -0,0 +1,75 @@
+package afdata
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+)
+
+func TestCaptureHandlerRecordsSpanAndEventFields(t *testing.T) {
+	h := NewCaptureHandler()
+	logger := slog.New(h).With("request_id", "r1")
+	logger.Info("done", "latency_ms", 42)
+	logger.Debug("detail")
+
+	records := h.Records()
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	r := records[0]
+	if r["message"] != "done" || r["code"] != "info" || r["request_id"] != "r1" || r["latency_ms"] != int64(42) {
+		t.Errorf("unexpected record: %v", r)
+	}
+	if _, ok := r["timestamp_epoch_ms"]; !ok {
+		t.Error("timestamp_epoch_ms missing")
+	}
+	if records[1]["code"] != "debug" || records[1]["request_id"] != "r1" {
+		t.Errorf("unexpected debug record: %v", records[1])
+	}
+}
+
+func TestCaptureHandlerSharedAcrossWithAttrs(t *testing.T) {
+	h := NewCaptureHandler()
+	slog.New(h).Info("root")
+	slog.New(h).With("span", "s").Warn("child", "code", "slow")
+
+	records := h.Records()
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	if _, ok := records[0]["span"]; ok {
+		t.Errorf("root record should not carry span field: %v", records[0])
+	}
+	if records[1]["span"] != "s" || records[1]["code"] != "slow" {
+		t.Errorf("unexpected child record: %v", records[1])
+	}
+}
+
+func TestCaptureHandlerRedactsSecretSpanFields(t *testing.T) {
+	h := NewCaptureHandler()
+	slog.New(h).With("api_key_secret", "sk-1").Info("call")
+	if got := h.Records()[0]["api_key_secret"]; got != "***" {
+		t.Errorf("api_key_secret = %v, want ***", got)
+	}
+}
+
+func TestCaptureHandlerSpanFieldsFromContext(t *testing.T) {
+	h := NewCaptureHandler()
+	ctx := WithSpan(context.Background(), map[string]any{"request_id": "r1"})
+	slog.New(h).InfoContext(ctx, "done")
+	if got := h.Records()[0]["request_id"]; got != "r1" {
+		t.Errorf("request_id = %v, want r1", got)
+	}
+}
+
+func TestCaptureHandlerWithGroup(t *testing.T) {
+	capture := NewCaptureHandler()
+	slog.New(capture).WithGroup("db").Info("query", "rows", 2)
+	records := capture.Records()
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(records))
+	}
+	if db, _ := records[0]["db"].(map[string]any); db["rows"] != int64(2) {
+		t.Errorf("record = %v, want rows under db", records[0])
+	}
+}
@@ -16,6 +16,9 @@ const (
 	OutputFormatJson  OutputFormat = "json"
 	OutputFormatYaml  OutputFormat = "yaml"
 	OutputFormatPlain OutputFormat = "plain"
+	OutputFormatCsv   OutputFormat = "csv"
+	OutputFormatToml  OutputFormat = "toml"
+	OutputFormatHtml  OutputFormat = "html" // passed to output hooks by OutputHtmlTable; not a CliOutput format
 )
 
 // CliParseOutput parses the --output flag value into an OutputFormat.
@@ -28,8 +31,12 @@ func CliParseOutput(s string) (OutputFormat, error) {
 		return OutputFormatYaml, nil
 	case "plain":
 		return OutputFormatPlain, nil
+	case "csv":
+		return OutputFormatCsv, nil
+	case "toml":
+		return OutputFormatToml, nil
 	default:
-		return "", fmt.Errorf("invalid --output format %q: expected json, yaml, or plain", s)
+		return "", fmt.Errorf("invalid --output format %q: expected json, yaml, plain, csv, or toml", s)
 	}
 }
 
@@ -57,18 +64,78 @@ func CliParseLogFilters(entries []string) []string {
 }
 
 // CliOutput dispatches output formatting by OutputFormat.
-// Equivalent to calling OutputJson, OutputYaml, or OutputPlain directly.
+// Equivalent to calling OutputJson, OutputYaml, OutputPlain, OutputCsv, or OutputToml directly.
 func CliOutput(value any, format OutputFormat) string {
 	switch format {
 	case OutputFormatYaml:
 		return OutputYaml(value)
 	case OutputFormatPlain:
 		return OutputPlain(value)
+	case OutputFormatCsv:
+		return OutputCsv(value)
+	case OutputFormatToml:
+		return OutputToml(value)
 	default:
 		return OutputJson(value)
 	}
 }
 
+// EmitOk formats BuildJsonOk(result, trace) in the given format, without a
+// trailing newline. Equivalent to CliOutput(BuildJsonOk(result, trace), format).
+func EmitOk(result any, trace any, format OutputFormat) string {
+	return CliOutput(BuildJsonOk(result, trace), format)
+}
+
+// EmitError formats BuildJsonError(message, "", nil) in the given format,
+// without a trailing newline.
+func EmitError(message string, format OutputFormat) string {
+	return CliOutput(BuildJsonError(message, "", nil), format)
+}
+
+// CliOutputWithType formats like CliOutput and also returns the media type
+// for transport headers: application/json, text/yaml, text/plain, text/csv,
+// or application/toml. CSV/TOML input that falls back to JSON reports
+// application/json.
+func CliOutputWithType(value any, format OutputFormat) (body string, mediaType string) {
+	switch format {
+	case OutputFormatYaml:
+		return OutputYaml(value), "text/yaml"
+	case OutputFormatPlain:
+		return OutputPlain(value), "text/plain"
+	case OutputFormatCsv:
+		if out, ok := formatCsv(value); ok {
+			return applyOutputHooks(OutputFormatCsv, out), "text/csv"
+		}
+		return applyOutputHooks(OutputFormatCsv, renderJSON(value)), "application/json"
+	case OutputFormatToml:
+		if _, ok := normalize(value).(map[string]any); ok {
+			return OutputToml(value), "application/toml"
+		}
+		return applyOutputHooks(OutputFormatToml, renderJSON(value)), "application/json"
+	default:
+		return OutputJson(value), "application/json"
+	}
+}
+
+// ExitCode maps an envelope to a process exit status. Success envelopes
+// (code "ok", "warning", "log" or "progress" with no "error" field) map to
+// 0. An error with error_code "invalid_request" (the BuildCliError
+// convention) maps to 2. Every other envelope maps to 1: errors, tool-defined
+// codes such as "not_found", and maps without a string code.
+func ExitCode(m map[string]any) int {
+	code, _ := m["code"].(string)
+	if _, hasError := m["error"]; !hasError {
+		switch code {
+		case "ok", "warning", "log", "progress":
+			return 0
+		}
+	}
+	if code == "error" && m["error_code"] == "invalid_request" {
+		return 2
+	}
+	return 1
+}
+
 // BuildCliError builds a standard CLI parse error value.
 // Use when flag parsing fails or a flag value is invalid.
 // Print with OutputJson and exit with code 2.
@@ -1,6 +1,7 @@
 package afdata
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -16,6 +17,8 @@ func TestCliParseOutput_AllFormats(t *testing.T) {
 		{"json", OutputFormatJson},
 		{"yaml", OutputFormatYaml},
 		{"plain", OutputFormatPlain},
+		{"csv", OutputFormatCsv},
+		{"toml", OutputFormatToml},
 	}
 	for _, c := range cases {
 		got, err := CliParseOutput(c.in)
@@ -38,12 +41,12 @@ func TestCliParseOutput_RejectsUnknown(t *testing.T) {
 }
 
 func TestCliParseOutput_ErrorContainsValue(t *testing.T) {
-	_, err := CliParseOutput("toml")
+	_, err := CliParseOutput("xml")
 	if err == nil {
 		t.Fatal("expected error")
 	}
 	msg := err.Error()
-	if !contains(msg, "toml") {
+	if !contains(msg, "xml") {
 		t.Errorf("error %q does not contain input value", msg)
 	}
 	if !contains(msg, "json") {
@@ -180,6 +183,49 @@ func TestCliOutput_DispatchesPlain(t *testing.T) {
 	}
 }
 
+func TestCliOutput_DispatchesCsv(t *testing.T) {
+	v := []any{map[string]any{"name": "a"}, map[string]any{"name": "b"}}
+	out := CliOutput(v, OutputFormatCsv)
+	if out != "name\na\nb" {
+		t.Errorf("csv output = %q", out)
+	}
+}
+
+// ═══════════════════════════════════════════
+// CliOutputWithType
+// ═══════════════════════════════════════════
+
+func TestCliOutputWithType_MediaTypes(t *testing.T) {
+	v := map[string]any{"code": "ok"}
+	cases := []struct {
+		format OutputFormat
+		want   string
+	}{
+		{OutputFormatJson, "application/json"},
+		{OutputFormatYaml, "text/yaml"},
+		{OutputFormatPlain, "text/plain"},
+		{OutputFormatCsv, "application/json"}, // non-tabular falls back to JSON
+		{OutputFormatToml, "application/toml"},
+	}
+	for _, c := range cases {
+		body, mediaType := CliOutputWithType(v, c.format)
+		if mediaType != c.want {
+			t.Errorf("%s: mediaType = %q, want %q", c.format, mediaType, c.want)
+		}
+		if body != CliOutput(v, c.format) {
+			t.Errorf("%s: body = %q, want CliOutput result", c.format, body)
+		}
+	}
+}
+
+func TestCliOutputWithType_Csv(t *testing.T) {
+	v := []any{map[string]any{"name": "a"}}
+	body, mediaType := CliOutputWithType(v, OutputFormatCsv)
+	if mediaType != "text/csv" || body != "name\na" {
+		t.Errorf("got (%q, %q)", body, mediaType)
+	}
+}
+
 // ═══════════════════════════════════════════
 // Helpers
 // ═══════════════════════════════════════════
@@ -207,3 +253,50 @@ func contains(s, sub string) bool {
 			return false
 		}())
 }
+
+func TestEmitOkAndErrorMatchComposedCalls(t *testing.T) {
+	result := map[string]any{"user_id": 123, "api_key_secret": "sk-1"}
+	trace := map[string]any{"duration_ms": 150}
+	for _, format := range []OutputFormat{OutputFormatJson, OutputFormatYaml, OutputFormatPlain, OutputFormatCsv, OutputFormatToml} {
+		if got, want := EmitOk(result, trace, format), CliOutput(BuildJsonOk(result, trace), format); got != want {
+			t.Errorf("EmitOk(%s) = %q, want %q", format, got, want)
+		}
+		if got, want := EmitError("not found", format), CliOutput(BuildJsonError("not found", "", nil), format); got != want {
+			t.Errorf("EmitError(%s) = %q, want %q", format, got, want)
+		}
+	}
+	if strings.HasSuffix(EmitOk(result, trace, OutputFormatJson), "\n") {
+		t.Error("EmitOk should not append a newline")
+	}
+}
+
+// ═══════════════════════════════════════════
+// ExitCode
+// ═══════════════════════════════════════════
+
+func TestExitCode(t *testing.T) {
+	cases := []struct {
+		name string
+		m    map[string]any
+		want int
+	}{
+		{"ok", BuildJsonOk(map[string]any{"id": 1}, nil), 0},
+		{"startup", BuildJsonStartup(nil, nil, nil), 0},
+		{"progress", BuildJson("progress", map[string]any{"done": 1}, nil), 0},
+		{"invalid_request", BuildCliError("missing --sql", ""), 2},
+		{"generic_error", BuildJsonError("not found", "", nil), 1},
+		{"coded_error", BuildJsonErrorCode("timeout", "upstream_timeout", true, nil), 1},
+		{"not_found", BuildJson("not_found", map[string]any{"error": "no user"}, nil), 1},
+		{"tool_defined", BuildJson("sync", map[string]any{"files": 3}, nil), 1},
+		{"ok_with_error", map[string]any{"code": "ok", "error": "partial"}, 1},
+		{"warning", BuildJsonWarning("deprecated flag", "deprecated", nil), 0},
+		{"non_envelope", map[string]any{"id": 1}, 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ExitCode(tc.m); got != tc.want {
+				t.Errorf("ExitCode = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package afdata
+
+import (
+	"html"
+	"sort"
+	"strings"
+)
+
+// ═══════════════════════════════════════════
+// Public API: HTML Table Output
+// ═══════════════════════════════════════════
+
+// OutputHtmlTable formats a map as an HTML <table> for web dashboards: one
+// <tr> per field with the stripped key in <th> and the formatted value in
+// <td>. Keys and values follow OutputPlain (secrets redacted, nested maps
+// flattened to dot keys, JCS order); all content is HTML-escaped. Non-map
+// input renders as a single <td> holding its OutputJson. Output hooks run
+// once on the whole table with OutputFormatHtml.
+func OutputHtmlTable(value any) string {
+	processed := prepareProcessed(value)
+	if _, ok := processed.(map[string]any); !ok {
+		return applyOutputHooks(OutputFormatHtml, "<table>\n<tr><td>"+html.EscapeString(renderJSON(value))+"</td></tr>\n</table>")
+	}
+	var pairs []plainPair
+	collectPlainPairs(processed, "", 1, &pairs)
+	sort.Slice(pairs, func(i, j int) bool {
+		return jcsLess(pairs[i].key, pairs[j].key)
+	})
+	var b strings.Builder
+	b.WriteString("<table>\n")
+	for _, p := range pairs {
+		b.WriteString("<tr><th>")
+		b.WriteString(html.EscapeString(p.key))
+		b.WriteString("</th><td>")
+		b.WriteString(html.EscapeString(p.value))
+		b.WriteString("</td></tr>\n")
+	}
+	b.WriteString("</table>")
+	return applyOutputHooks(OutputFormatHtml, b.String())
+}
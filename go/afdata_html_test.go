@@ -0,0 +1,52 @@
+package afdata
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOutputHtmlTableStructure(t *testing.T) {
+	got := OutputHtmlTable(map[string]any{
+		"name":       "alice",
+		"latency_ms": 1500,
+		"db":         map[string]any{"host": "localhost"},
+	})
+	want := "<table>\n" +
+		"<tr><th>db.host</th><td>localhost</td></tr>\n" +
+		"<tr><th>latency</th><td>1.5s</td></tr>\n" +
+		"<tr><th>name</th><td>alice</td></tr>\n" +
+		"</table>"
+	assertEqual(t, got, want)
+}
+
+func TestOutputHtmlTableEscapes(t *testing.T) {
+	got := OutputHtmlTable(map[string]any{"<b>key</b>": "a < b & c"})
+	assertContains(t, got, "<th>&lt;b&gt;key&lt;/b&gt;</th>")
+	assertContains(t, got, "<td>a &lt; b &amp; c</td>")
+	assertNotContains(t, got, "<b>")
+}
+
+func TestOutputHtmlTableRedactsSecrets(t *testing.T) {
+	got := OutputHtmlTable(map[string]any{"api_key_secret": "sk-live-123", "user": "alice"})
+	assertContains(t, got, "<tr><th>api_key</th><td>***</td></tr>")
+	assertNotContains(t, got, "sk-live-123")
+}
+
+func TestOutputHtmlTableNonMap(t *testing.T) {
+	assertEqual(t, OutputHtmlTable([]any{"<x>"}), "<table>\n<tr><td>[&#34;\\u003cx\\u003e&#34;]</td></tr>\n</table>")
+}
+
+func TestOutputHtmlTableRunsHooks(t *testing.T) {
+	var seen []OutputFormat
+	setOutputHooksForTest(t, func(format OutputFormat, s string) string {
+		seen = append(seen, format)
+		return strings.ReplaceAll(s, "db01.internal", "&lt;host&gt;")
+	})
+	assertEqual(t, OutputHtmlTable(map[string]any{"host": "db01.internal"}),
+		"<table>\n<tr><th>host</th><td>&lt;host&gt;</td></tr>\n</table>")
+	assertEqual(t, OutputHtmlTable([]any{"db01.internal"}),
+		"<table>\n<tr><td>[&#34;&lt;host&gt;&#34;]</td></tr>\n</table>")
+	if len(seen) != 2 || seen[0] != OutputFormatHtml || seen[1] != OutputFormatHtml {
+		t.Errorf("hook formats = %q, want two %q calls", seen, OutputFormatHtml)
+	}
+}
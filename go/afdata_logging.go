@@ -1,12 +1,18 @@
 package afdata
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"runtime"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // LogFormat controls the output format of the AFDATA handler.
@@ -19,28 +25,90 @@ const (
 	FormatPlain
 	// FormatYaml outputs multi-line YAML (keys stripped, values formatted).
 	FormatYaml
+	// FormatEcs outputs single-line JSON shaped for Elastic Common Schema:
+	// @timestamp, log.level, message and ecs.version at the top, every other
+	// field (code included) under "afdata" as FormatJson would write it.
+	FormatEcs
 )
 
+// ecsVersion is the Elastic Common Schema version FormatEcs lines declare.
+const ecsVersion = "8.11.0"
+
 // AfdataHandler implements slog.Handler, outputting AFDATA-compliant log lines.
 //
 // Each log line contains: timestamp_epoch_ms, message, code, plus
 // any span-level (WithAttrs) and event-level fields.
 // Output is formatted via the library's own OutputJson/OutputPlain/OutputYaml.
 type AfdataHandler struct {
-	out    io.Writer
-	mu     *sync.Mutex
-	attrs  []slog.Attr
-	format LogFormat
-	level  slog.Level
+	out           io.Writer
+	mu            *sync.Mutex
+	attrs         []slog.Attr
+	groups        []logGroup
+	format        LogFormat
+	level         slog.Leveler
+	addSource     bool
+	syncEach      bool
+	msgKey        string
+	omitEmpty     bool
+	humanTime     bool
+	errorEnvelope bool
+	router        func(code string) io.Writer
+	codes         map[string]bool
+	buf           *lineBuffer
+	coalesce      *coalesceState
+	async         *asyncState
+}
+
+// logGroup is a WithGroup level: its name and the fields attached via
+// WithAttrs while it was the innermost group.
+type logGroup struct {
+	name  string
+	attrs []slog.Attr
+}
+
+// asyncState is the queue of a non-blocking handler. A single goroutine
+// drains lines to the writer; closed is guarded by the handler mutex.
+type asyncState struct {
+	lines   chan asyncLine
+	done    chan struct{}
+	dropped atomic.Int64
+	closed  bool
+}
+
+type asyncLine struct {
+	out  io.Writer
+	line string
+	sync bool
+}
+
+// coalesceState tracks the last line written by a coalescing handler.
+// Shared by all handlers derived via WithAttrs; guarded by the handler mutex.
+type coalesceState struct {
+	last     string // last line's formatted fields, excluding the timestamp
+	code     string
+	repeated int
 }
 
 // NewAfdataHandler creates a new AFDATA handler writing to w with the given format.
+// Its minimum level is slog.LevelInfo: debug and trace records are dropped.
 func NewAfdataHandler(w io.Writer, format LogFormat) *AfdataHandler {
 	return NewAfdataHandlerWithLevel(w, format, slog.LevelInfo)
 }
 
-// NewAfdataHandlerWithLevel creates a new AFDATA handler with a minimum enabled level.
+// NewAfdataHandlerWithLevel creates a new AFDATA handler with a fixed minimum
+// enabled level. Use NewAfdataHandlerWithLeveler to change it at runtime.
 func NewAfdataHandlerWithLevel(w io.Writer, format LogFormat, level slog.Level) *AfdataHandler {
+	return NewAfdataHandlerWithLeveler(w, format, level)
+}
+
+// NewAfdataHandlerWithLeveler is NewAfdataHandlerWithLevel for any
+// slog.Leveler: the minimum level is read from level on every record, so a
+// *slog.LevelVar can change it at runtime. A nil level means slog.LevelInfo,
+// the NewAfdataHandler default.
+func NewAfdataHandlerWithLeveler(w io.Writer, format LogFormat, level slog.Leveler) *AfdataHandler {
+	if level == nil {
+		level = slog.LevelInfo
+	}
 	return &AfdataHandler{out: w, mu: &sync.Mutex{}, format: format, level: level}
 }
 
@@ -76,65 +144,543 @@ func InitYamlLevel(level slog.Level) {
 
 // Enabled returns whether the level is enabled for this handler.
 func (h *AfdataHandler) Enabled(_ context.Context, level slog.Level) bool {
-	return level >= h.level
+	return level >= h.level.Level()
 }
 
 // Handle outputs a single AFDATA-compliant log line.
-func (h *AfdataHandler) Handle(_ context.Context, r slog.Record) error {
+func (h *AfdataHandler) Handle(ctx context.Context, r slog.Record) error {
+	m := h.buildRecord(ctx, r)
+	code, _ := m["code"].(string)
+	if h.codes != nil && !h.codes[code] {
+		return nil
+	}
+	out := h.writerFor(code)
+	level := levelToCode(r.Level)
+	if h.coalesce == nil {
+		line := h.formatLine(m, level)
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return h.writeLocked(out, line)
+	}
+
+	// Compare without the timestamp, which differs on every line.
+	line := h.formatLine(m, level)
+	delete(m, "timestamp_epoch_ms")
+	delete(m, "timestamp_rfc3339")
+	key := h.formatLine(m, level)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c := h.coalesce
+	if key == c.last {
+		c.repeated++
+		return nil
+	}
+	if err := h.flushRepeatedLocked(); err != nil {
+		return err
+	}
+	c.last = key
+	c.code = code
+	return h.writeLocked(out, line)
+}
+
+// buildRecord builds the field map for r: timestamp, message, source, span
+// and event attrs, and the resolved code. Registered context fields
+// (RegisterContextField) are applied first, then span fields from ctx
+// (WithSpan), then WithAttrs fields in attach order, then event fields, so
+// an event field always overrides a span field with the same key, and a
+// later event field overrides an earlier one. Fields attached after
+// WithGroup, and all event fields under a group, nest in a map under the
+// group name; a group that ends up empty is left out.
+func (h *AfdataHandler) buildRecord(ctx context.Context, r slog.Record) map[string]any {
 	m := make(map[string]any, 4+len(h.attrs)+r.NumAttrs())
 
-	m["timestamp_epoch_ms"] = r.Time.UnixMilli()
-	m["message"] = r.Message
+	ts := r.Time
+	if ts.IsZero() {
+		ts = now()
+	}
+	h.setTimestamp(m, ts)
+	asError := h.errorEnvelope && r.Level >= slog.LevelError
+	if !asError && (r.Message != "" || !h.omitEmpty) {
+		m[h.messageKey()] = r.Message
+	}
+	if h.addSource && r.PC != 0 {
+		m["source"] = recordSource(r.PC)
+	}
 
 	defaultCode := levelToCode(r.Level)
 
-	// Span-level fields (from WithAttrs)
+	// Span-level fields (registered context values, the WithSpan context, then WithAttrs)
+	addContextFields(ctx, m)
+	for _, a := range spanAttrs(ctx) {
+		m[a.Key] = attrValue(a.Value)
+	}
 	for _, a := range h.attrs {
 		m[a.Key] = attrValue(a.Value)
 	}
+	target := m
+	parents := make([]map[string]any, len(h.groups))
+	for i, g := range h.groups {
+		sub, ok := target[g.name].(map[string]any)
+		if !ok {
+			sub = make(map[string]any, len(g.attrs)+r.NumAttrs())
+		}
+		for _, a := range g.attrs {
+			sub[a.Key] = attrValue(a.Value)
+		}
+		target[g.name] = sub
+		parents[i] = target
+		target = sub
+	}
 
 	// Event-level fields (override span fields on collision)
 	hasCode := false
 	r.Attrs(func(a slog.Attr) bool {
-		if a.Key == "code" {
+		if a.Key == "code" && len(h.groups) == 0 {
 			hasCode = true
 		}
-		m[a.Key] = attrValue(a.Value)
+		target[a.Key] = attrValue(a.Value)
 		return true
 	})
+	for i := len(h.groups) - 1; i >= 0; i-- {
+		name := h.groups[i].name
+		if len(parents[i][name].(map[string]any)) > 0 {
+			break
+		}
+		delete(parents[i], name)
+	}
 
-	if !hasCode {
+	// The error envelope is applied last so attrs named "error" or "code"
+	// cannot replace the message or the code.
+	if asError {
+		m["error"] = r.Message
+	}
+	if !hasCode || asError {
 		m["code"] = defaultCode
 	}
+	return m
+}
+
+// setTimestamp sets timestamp_epoch_ms, plus timestamp_rfc3339 with
+// WithHumanTimestamp. Plain and YAML already render the epoch as a readable
+// time, so there the readable field replaces it rather than collide with it.
+// FormatEcs always writes a readable @timestamp, so it only needs the epoch.
+func (h *AfdataHandler) setTimestamp(m map[string]any, ts time.Time) {
+	ms := ts.UnixMilli()
+	if !h.humanTime || h.format == FormatEcs {
+		m["timestamp_epoch_ms"] = ms
+		return
+	}
+	m["timestamp_rfc3339"] = formatRFC3339Ms(ms)
+	if h.format == FormatJson {
+		m["timestamp_epoch_ms"] = ms
+	}
+}
 
-	// Format using the library's own output functions
-	var line string
+// writerFor returns the writer for a record with the given code: the
+// WithCodeRouter choice, or the handler's writer when there is no router or
+// it returns nil.
+func (h *AfdataHandler) writerFor(code string) io.Writer {
+	if h.router != nil {
+		if w := h.router(code); w != nil {
+			return w
+		}
+	}
+	return h.out
+}
+
+// writeLocked writes one line to out, or queues it when non-blocking
+// (dropping it if the queue is full). Caller must hold h.mu.
+func (h *AfdataHandler) writeLocked(out io.Writer, line string) error {
+	if a := h.async; a != nil && !a.closed {
+		select {
+		case a.lines <- asyncLine{out: out, line: line, sync: h.syncEach}:
+		default:
+			a.dropped.Add(1)
+		}
+		return nil
+	}
+	return writeLine(out, line, h.syncEach)
+}
+
+// writeLine writes one line and, if sync is set, syncs or flushes w.
+func writeLine(out io.Writer, line string, sync bool) error {
+	if _, err := io.WriteString(out, line+"\n"); err != nil {
+		return err
+	}
+	if !sync {
+		return nil
+	}
+	switch w := out.(type) {
+	case interface{ Sync() error }: // *os.File
+		return w.Sync()
+	case interface{ Flush() error }: // *bufio.Writer
+		return w.Flush()
+	case interface{ Flush() }: // http.Flusher
+		w.Flush()
+	}
+	return nil
+}
+
+// formatLine formats using the library's own output functions. level is the
+// record's level as a code (FormatEcs log.level), kept apart from m because
+// an attr may override code.
+func (h *AfdataHandler) formatLine(m map[string]any, level string) string {
 	switch h.format {
 	case FormatPlain:
-		line = OutputPlain(m)
+		return OutputPlain(m)
 	case FormatYaml:
-		line = OutputYaml(m)
+		return OutputYaml(m)
+	case FormatEcs:
+		return OutputJson(h.ecsRecord(m, level))
 	default:
-		line = OutputJson(m)
+		return OutputJson(m)
+	}
+}
+
+// ecsRecord reshapes a record map for FormatEcs, with level as log.level.
+func (h *AfdataHandler) ecsRecord(m map[string]any, level string) map[string]any {
+	payload := make(map[string]any, len(m))
+	for k, v := range m {
+		payload[k] = v
+	}
+	out := map[string]any{
+		"ecs": map[string]any{"version": ecsVersion},
+		"log": map[string]any{"level": level},
+	}
+	if ms, ok := payload["timestamp_epoch_ms"].(int64); ok {
+		out["@timestamp"] = time.UnixMilli(ms).UTC().Format("2006-01-02T15:04:05.000Z")
+		delete(payload, "timestamp_epoch_ms")
+	}
+	if msg, ok := payload[h.messageKey()]; ok {
+		out["message"] = msg
+		delete(payload, h.messageKey())
+	}
+	out["afdata"] = payload
+	return out
+}
+
+// flushRepeatedLocked writes the pending "(repeated N times)" summary, if any.
+// Caller must hold h.mu.
+func (h *AfdataHandler) flushRepeatedLocked() error {
+	c := h.coalesce
+	if c == nil || c.repeated == 0 {
+		return nil
 	}
+	m := map[string]any{
+		h.messageKey(): fmt.Sprintf("(repeated %d times)", c.repeated),
+		"code":         c.code,
+		"repeated":     c.repeated,
+	}
+	h.setTimestamp(m, now())
+	line := h.formatLine(m, c.code)
+	c.repeated = 0
+	return h.writeLocked(h.writerFor(c.code), line)
+}
 
+// Close flushes a pending repeat summary when coalescing is enabled, for
+// a non-blocking handler waits until queued lines are written (later records
+// are written synchronously), and flushes a WithBuffer buffer. It does not
+// close the underlying writer.
+func (h *AfdataHandler) Close() error {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	_, err := io.WriteString(h.out, line+"\n")
+	err := h.flushRepeatedLocked()
+	if h.coalesce != nil {
+		h.coalesce.last = ""
+	}
+	if a := h.async; a != nil && !a.closed {
+		a.closed = true
+		close(a.lines)
+		<-a.done
+	}
+	if h.buf != nil {
+		if ferr := h.buf.Flush(); err == nil {
+			err = ferr
+		}
+	}
 	return err
 }
 
+// Flush writes lines held by a buffered handler (see WithBuffer) to the
+// underlying writer. Lines still queued by WithNonBlocking are not waited
+// for; use Close for that. A no-op without WithBuffer.
+func (h *AfdataHandler) Flush() error {
+	if h.buf == nil {
+		return nil
+	}
+	return h.buf.Flush()
+}
+
+// DroppedCount returns how many lines a non-blocking handler dropped because
+// its queue was full. Always 0 without WithNonBlocking.
+func (h *AfdataHandler) DroppedCount() int64 {
+	if h.async == nil {
+		return 0
+	}
+	return h.async.dropped.Load()
+}
+
 // WithAttrs returns a new handler with additional span-level fields.
+// Secret span fields are redacted here at any depth, so the handler never
+// retains them: group, map and LogValuer values are stored as redacted
+// copies (a LogValuer is resolved once, here).
+// A field attached later (by a later WithAttrs or WithSpan, or later in
+// attrs) replaces an earlier one with the same key.
 func (h *AfdataHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
-	combined := make([]slog.Attr, len(h.attrs), len(h.attrs)+len(attrs))
-	copy(combined, h.attrs)
-	combined = append(combined, attrs...)
-	return &AfdataHandler{out: h.out, mu: h.mu, attrs: combined, format: h.format, level: h.level}
+	c := h.clone()
+	if n := len(h.groups); n > 0 {
+		c.groups = append([]logGroup(nil), h.groups...)
+		c.groups[n-1].attrs = mergeAttrs(h.groups[n-1].attrs, attrs)
+		return c
+	}
+	c.attrs = mergeAttrs(h.attrs, attrs)
+	return c
+}
+
+// mergeAttrs returns base plus attrs, redacting secret-keyed attrs and secrets
+// nested inside container values. The last attr for each key wins and
+// replaces any earlier one in base.
+func mergeAttrs(base, attrs []slog.Attr) []slog.Attr {
+	// Walk backwards so the last attr for each key wins.
+	seen := make(map[string]bool, len(attrs))
+	added := make([]slog.Attr, 0, len(attrs))
+	patterns := currentRedactionPatterns()
+	for i := len(attrs) - 1; i >= 0; i-- {
+		a := attrs[i]
+		if seen[a.Key] {
+			continue
+		}
+		seen[a.Key] = true
+		switch a.Value.Kind() {
+		case slog.KindGroup, slog.KindAny, slog.KindLogValuer:
+			a = redactedAttr(a, patterns)
+		default:
+			if isSecretKey(a.Key) || matchesRedactionPattern(a.Key, patterns) {
+				a = redactedAttr(a, patterns)
+			}
+		}
+		added = append(added, a)
+	}
+	combined := make([]slog.Attr, 0, len(base)+len(added))
+	for _, a := range base {
+		if !seen[a.Key] {
+			combined = append(combined, a)
+		}
+	}
+	for i := len(added) - 1; i >= 0; i-- {
+		combined = append(combined, added[i])
+	}
+	return combined
+}
+
+// redactedAttr converts a to a plain value (a fresh copy, see attrValue) and
+// redacts secrets in it, including secret keys nested at any depth.
+func redactedAttr(a slog.Attr, patterns []string) slog.Attr {
+	m := map[string]any{a.Key: attrValue(a.Value)}
+	redactSecretsWith(m, patterns)
+	return slog.Any(a.Key, m[a.Key])
+}
+
+// WithGroup returns a new handler that nests later WithAttrs fields and all
+// event fields in a map under name: logger.WithGroup("db").Info("", "query_ms", 5)
+// renders {"db":{"query_ms":5}} in JSON and db.query=5ms in plain. Nested
+// groups compose. An empty name returns the handler unchanged.
+func (h *AfdataHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	c := h.clone()
+	c.groups = append(append([]logGroup(nil), h.groups...), logGroup{name: name})
+	return c
 }
 
-// WithGroup returns the handler unchanged (groups are not used in AFDATA output).
-func (h *AfdataHandler) WithGroup(_ string) slog.Handler {
-	return h
+// WithAddSource returns a new handler that, when enabled, adds a source field
+// ("file.go:42") with the caller location of each record. Default off.
+func (h *AfdataHandler) WithAddSource(enabled bool) *AfdataHandler {
+	c := h.clone()
+	c.addSource = enabled
+	return c
+}
+
+// WithMessageKey returns a new handler that stores the record message under
+// key instead of "message" (e.g. "msg" or "event"). Pick a key without an
+// AFDATA suffix so it is not reformatted; like any field, an attr with the
+// same key overrides it. Empty restores "message".
+func (h *AfdataHandler) WithMessageKey(key string) *AfdataHandler {
+	c := h.clone()
+	c.msgKey = key
+	return c
+}
+
+func (h *AfdataHandler) messageKey() string {
+	if h.msgKey == "" {
+		return "message"
+	}
+	return h.msgKey
+}
+
+// WithOmitEmptyMessage returns a new handler that, when enabled, leaves out
+// the message field for records with an empty message (logger.Info("", ...)
+// with all data in attrs). Default off: message is always present.
+func (h *AfdataHandler) WithOmitEmptyMessage(enabled bool) *AfdataHandler {
+	c := h.clone()
+	c.omitEmpty = enabled
+	return c
+}
+
+// WithHumanTimestamp returns a new handler that, when enabled, also writes
+// the record time as timestamp_rfc3339 ("2025-02-07T00:00:00.000Z", honoring
+// SetTimestampLayout) so JSONL stays readable; timestamp_epoch_ms is kept
+// for parsers. Plain and YAML lines look the same either way (timestamp=...).
+// Default off.
+func (h *AfdataHandler) WithHumanTimestamp(enabled bool) *AfdataHandler {
+	c := h.clone()
+	c.humanTime = enabled
+	return c
+}
+
+// WithErrorEnvelope returns a new handler that, when enabled, shapes
+// Error-level records like BuildJsonError: the message goes under "error"
+// (not the message key) and code is always "error". Both are set after all
+// attributes, so an attr named "error" or "code" is overwritten rather than
+// hiding the message. Default off.
+func (h *AfdataHandler) WithErrorEnvelope(enabled bool) *AfdataHandler {
+	c := h.clone()
+	c.errorEnvelope = enabled
+	return c
+}
+
+// WithSyncEachWrite returns a new handler that, when enabled, syncs the
+// writer after each record for crash safety: Sync() error (e.g. *os.File),
+// Flush() error (e.g. *bufio.Writer) or Flush() (e.g. http.Flusher), called
+// under the write lock. Default off for throughput.
+func (h *AfdataHandler) WithSyncEachWrite(enabled bool) *AfdataHandler {
+	c := h.clone()
+	c.syncEach = enabled
+	return c
+}
+
+// WithNonBlocking returns a new handler that hands formatted lines to a
+// background goroutine through a queue of the given size, so a slow or
+// blocked writer never stalls logging. When the queue is full the line is
+// dropped and counted (see DroppedCount): completeness is traded for latency
+// under overload. Write errors are discarded. Call Close to drain the queue.
+// Handlers derived via WithAttrs share the queue. buffer <= 0 disables it.
+func (h *AfdataHandler) WithNonBlocking(buffer int) *AfdataHandler {
+	c := h.clone()
+	c.async = nil
+	if buffer > 0 {
+		a := &asyncState{lines: make(chan asyncLine, buffer), done: make(chan struct{})}
+		go func() {
+			defer close(a.done)
+			for l := range a.lines {
+				_ = writeLine(l.out, l.line, l.sync)
+			}
+		}()
+		c.async = a
+	}
+	return c
+}
+
+// WithCodeRouter returns a new handler that writes each record to the writer
+// route returns for its resolved code (e.g. "error" to a separate error log),
+// falling back to the handler's writer when route returns nil. All writers
+// share the handler's lock. nil removes routing.
+func (h *AfdataHandler) WithCodeRouter(route func(code string) io.Writer) *AfdataHandler {
+	c := h.clone()
+	c.router = route
+	return c
+}
+
+// WithCodeFilter returns a new handler that writes only records whose
+// resolved code (after event-level code overrides) is in codes, e.g.
+// ["startup", "request", "error"]. Codes are normalized like
+// CliParseLogFilters. An empty list removes the filter.
+func (h *AfdataHandler) WithCodeFilter(codes []string) *AfdataHandler {
+	c := h.clone()
+	c.codes = nil
+	if normalized := CliParseLogFilters(codes); len(normalized) > 0 {
+		c.codes = make(map[string]bool, len(normalized))
+		for _, code := range normalized {
+			c.codes[code] = true
+		}
+	}
+	return c
+}
+
+// WithBuffer returns a new handler that batches lines in a buffer of size
+// bytes, turning one write per record into one write per batch. The buffer is
+// written out when the next line would not fit, and on Flush or Close; call
+// one of them before exit. Lines are never split across writes, so ordering
+// and one-line-per-record hold for the underlying writer. Handlers derived via
+// WithAttrs share the buffer. size <= 0 removes buffering (Flush first).
+// Writers chosen by WithCodeRouter are not buffered.
+func (h *AfdataHandler) WithBuffer(size int) *AfdataHandler {
+	c := h.clone()
+	if h.buf != nil {
+		c.out = h.buf.dst
+	}
+	c.buf = nil
+	if size > 0 {
+		c.buf = &lineBuffer{dst: c.out, w: bufio.NewWriterSize(c.out, size)}
+		c.out = c.buf
+	}
+	return c
+}
+
+// lineBuffer is the write buffer of a buffered handler. It has its own lock
+// because a non-blocking handler writes to it without the handler mutex.
+type lineBuffer struct {
+	mu  sync.Mutex
+	dst io.Writer
+	w   *bufio.Writer
+}
+
+// Write buffers one line, first flushing buffered lines if it would not fit,
+// so a flush never ends mid-line.
+func (b *lineBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.w.Buffered() > 0 && len(p) > b.w.Available() {
+		if err := b.w.Flush(); err != nil {
+			return 0, err
+		}
+	}
+	return b.w.Write(p)
+}
+
+// Flush writes buffered lines to the underlying writer.
+func (b *lineBuffer) Flush() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.w.Flush()
+}
+
+// WithCoalesce returns a new handler that, when enabled, suppresses
+// consecutive lines identical apart from their timestamp. When a different
+// line arrives (or on Close), a "(repeated N times)" summary line carrying
+// the repeated line's code and a repeated: N field is written first.
+// Handlers derived via WithAttrs share the coalescing state. Default off.
+func (h *AfdataHandler) WithCoalesce(enabled bool) *AfdataHandler {
+	c := h.clone()
+	c.coalesce = nil
+	if enabled {
+		c.coalesce = &coalesceState{}
+	}
+	return c
+}
+
+// clone returns a shallow copy sharing the writer and mutex.
+func (h *AfdataHandler) clone() *AfdataHandler {
+	c := *h
+	return &c
+}
+
+func recordSource(pc uintptr) string {
+	frames := runtime.CallersFrames([]uintptr{pc})
+	f, _ := frames.Next()
+	return fmt.Sprintf("%s:%d", filepath.Base(f.File), f.Line)
 }
 
 func levelToCode(l slog.Level) string {
@@ -205,15 +751,123 @@ func Span(fields map[string]any, fn func()) {
 
 type spanKey struct{}
 
-// WithSpan returns a context carrying a logger with the given fields.
+// spanAttrsKey holds the accumulated, redacted fields of all WithSpan calls.
+type spanAttrsKey struct{}
+
+// WithSpan returns a context carrying a logger with the given fields. The
+// fields also reach any AfdataHandler logged through with this context
+// (slog.InfoContext(ctx, ...)), whichever logger is used.
+//
+// AfdataHandler, SampledTeeHandler and CaptureHandler read span fields only
+// from the context, so the fields land once at the top level even inside a
+// WithGroup. Other handlers receive them through WithAttrs.
 func WithSpan(ctx context.Context, fields map[string]any) context.Context {
-	parent := LoggerFromContext(ctx)
+	parent := LoggerFromContext(ctx).Handler()
 	attrs := make([]slog.Attr, 0, len(fields))
 	for k, v := range fields {
 		attrs = append(attrs, slog.Any(k, v))
 	}
-	child := slog.New(parent.Handler().WithAttrs(attrs))
-	return context.WithValue(ctx, spanKey{}, child)
+	merged := mergeAttrs(spanAttrs(ctx), attrs)
+	ctx = context.WithValue(ctx, spanAttrsKey{}, merged)
+	var child slog.Handler
+	switch h := parent.(type) {
+	case *spanHandler:
+		child = &spanHandler{inner: h.inner, attrs: mergeAttrs(h.attrs, attrs)}
+	case *AfdataHandler, *SampledTeeHandler, *CaptureHandler:
+		child = &spanHandler{inner: parent, attrs: merged}
+	default:
+		child = parent.WithAttrs(attrs)
+	}
+	return context.WithValue(ctx, spanKey{}, slog.New(child))
+}
+
+// spanHandler is the handler of a WithSpan logger over an AFDATA handler.
+// It passes its span fields through the record context, where buildRecord
+// reads them, instead of attaching them a second time with WithAttrs.
+type spanHandler struct {
+	inner slog.Handler
+	attrs []slog.Attr
+}
+
+func (h *spanHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+// Handle adds the logger's span fields to ctx; they override span fields
+// already in ctx with the same key.
+func (h *spanHandler) Handle(ctx context.Context, r slog.Record) error {
+	attrs := h.attrs
+	if base := spanAttrs(ctx); len(base) > 0 {
+		attrs = mergeAttrs(base, attrs)
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return h.inner.Handle(context.WithValue(ctx, spanAttrsKey{}, attrs), r)
+}
+
+func (h *spanHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &spanHandler{inner: h.inner.WithAttrs(attrs), attrs: h.attrs}
+}
+
+func (h *spanHandler) WithGroup(name string) slog.Handler {
+	return &spanHandler{inner: h.inner.WithGroup(name), attrs: h.attrs}
+}
+
+func spanAttrs(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	attrs, _ := ctx.Value(spanAttrsKey{}).([]slog.Attr)
+	return attrs
+}
+
+type contextField struct {
+	key  any
+	name string
+}
+
+var (
+	contextFieldsMu sync.RWMutex
+	contextFields   []contextField
+)
+
+// RegisterContextField makes every AfdataHandler add ctx.Value(ctxKey) as
+// fieldName to records logged with a context carrying it
+// (slog.InfoContext(ctx, ...)), so a request ID stored in the context
+// reaches each line without WithSpan. Absent (nil) values are skipped. Span
+// and event fields with the same name win. Re-registering ctxKey renames the
+// field; an empty fieldName removes it. Intended to be called at init; safe
+// for concurrent use.
+func RegisterContextField(ctxKey any, fieldName string) {
+	contextFieldsMu.Lock()
+	defer contextFieldsMu.Unlock()
+	for i, f := range contextFields {
+		if f.key == ctxKey {
+			if fieldName == "" {
+				contextFields = append(contextFields[:i:i], contextFields[i+1:]...)
+			} else {
+				contextFields[i].name = fieldName
+			}
+			return
+		}
+	}
+	if fieldName != "" {
+		contextFields = append(contextFields, contextField{ctxKey, fieldName})
+	}
+}
+
+func addContextFields(ctx context.Context, m map[string]any) {
+	if ctx == nil {
+		return
+	}
+	contextFieldsMu.RLock()
+	defer contextFieldsMu.RUnlock()
+	for _, f := range contextFields {
+		if v := ctx.Value(f.key); v != nil {
+			m[f.name] = attrValue(slog.AnyValue(v))
+		}
+	}
 }
 
 // LoggerFromContext returns the span logger from the context, or slog.Default().
@@ -5,8 +5,14 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func parseJSONLine(t *testing.T, buf *bytes.Buffer) map[string]any {
@@ -273,3 +279,951 @@ func TestAfdataHandlerYamlFormat(t *testing.T) {
 		t.Errorf("yaml output should start with ---, got: %s", line)
 	}
 }
+
+func TestAfdataHandlerAddSource(t *testing.T) {
+	for _, format := range []LogFormat{FormatJson, FormatPlain, FormatYaml} {
+		var buf bytes.Buffer
+		logger := slog.New(NewAfdataHandler(&buf, format).WithAddSource(true))
+		logger.Info("with source")
+		line := buf.String()
+		if !strings.Contains(line, "afdata_logging_test.go:") {
+			t.Errorf("format %d: expected source field, got: %s", format, line)
+		}
+		if !strings.Contains(line, "source") {
+			t.Errorf("format %d: expected source key, got: %s", format, line)
+		}
+	}
+}
+
+func TestAfdataHandlerSourceOffByDefault(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewAfdataHandler(&buf, FormatJson))
+	logger.Info("no source")
+	m := parseJSONLine(t, &buf)
+	if _, ok := m["source"]; ok {
+		t.Errorf("source should be absent by default, got %v", m["source"])
+	}
+}
+
+func TestAfdataHandlerAddSourceSkipsZeroPC(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewAfdataHandler(&buf, FormatJson).WithAddSource(true)
+	if err := h.Handle(context.Background(), slog.NewRecord(time.Now(), slog.LevelInfo, "no caller", 0)); err != nil {
+		t.Fatal(err)
+	}
+	m := parseJSONLine(t, &buf)
+	if _, ok := m["source"]; ok {
+		t.Errorf("record without PC should have no source, got %v", m["source"])
+	}
+}
+
+func jsonLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var out []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var m map[string]any
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("failed to parse JSON: %v\nraw: %s", err, line)
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+func TestAfdataHandlerCoalesceRepeatedLines(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewAfdataHandler(&buf, FormatJson).WithCoalesce(true))
+	for i := 0; i < 4; i++ {
+		logger.Warn("retrying", "attempt_limit", 5)
+	}
+	if got := strings.Count(buf.String(), "\n"); got != 1 {
+		t.Fatalf("expected 1 line before a different record, got %d: %s", got, buf.String())
+	}
+	logger.Info("done")
+	lines := jsonLines(t, &buf)
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %d", len(lines))
+	}
+	summary := lines[1]
+	if summary["message"] != "(repeated 3 times)" || summary["code"] != "warn" || summary["repeated"] != float64(3) {
+		t.Errorf("unexpected summary line: %v", summary)
+	}
+	if lines[2]["message"] != "done" {
+		t.Errorf("expected final line 'done', got %v", lines[2])
+	}
+}
+
+func TestAfdataHandlerCoalesceFlushOnClose(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewAfdataHandler(&buf, FormatPlain).WithCoalesce(true)
+	logger := slog.New(h)
+	logger.Info("tick")
+	logger.Info("tick")
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, `message="(repeated 1 times)"`) {
+		t.Errorf("expected summary after Close, got: %s", out)
+	}
+	// After Close the next identical line is written again.
+	buf.Reset()
+	logger.Info("tick")
+	if !strings.Contains(buf.String(), "message=tick") {
+		t.Errorf("expected line after Close, got: %s", buf.String())
+	}
+}
+
+func TestAfdataHandlerCoalesceConcurrent(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewAfdataHandler(&buf, FormatJson).WithCoalesce(true)
+	logger := slog.New(h.WithAttrs([]slog.Attr{slog.String("worker", "w")}))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				logger.Info("same")
+			}
+		}()
+	}
+	wg.Wait()
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	lines := jsonLines(t, &buf)
+	if len(lines) != 2 || lines[1]["repeated"] != float64(199) {
+		t.Errorf("expected 1 line + summary of 199 repeats, got %v", lines)
+	}
+}
+
+func TestAfdataHandlerCoalesceOffByDefault(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewAfdataHandler(&buf, FormatJson))
+	logger.Info("same")
+	logger.Info("same")
+	if got := strings.Count(buf.String(), "\n"); got != 2 {
+		t.Errorf("expected 2 lines, got %d", got)
+	}
+}
+
+type syncCountingWriter struct {
+	bytes.Buffer
+	syncs int
+}
+
+func (w *syncCountingWriter) Sync() error {
+	w.syncs++
+	return nil
+}
+
+type flushCountingWriter struct {
+	bytes.Buffer
+	flushes int
+}
+
+func (w *flushCountingWriter) Flush() {
+	w.flushes++
+}
+
+func TestAfdataHandlerSyncEachWrite(t *testing.T) {
+	w := &syncCountingWriter{}
+	logger := slog.New(NewAfdataHandler(w, FormatJson).WithSyncEachWrite(true))
+	logger.Info("one")
+	logger.Info("two")
+	if w.syncs != 2 {
+		t.Errorf("expected 2 syncs, got %d", w.syncs)
+	}
+}
+
+func TestAfdataHandlerSyncEachWriteFlusher(t *testing.T) {
+	w := &flushCountingWriter{}
+	logger := slog.New(NewAfdataHandler(w, FormatPlain).WithSyncEachWrite(true))
+	logger.Info("one")
+	if w.flushes != 1 {
+		t.Errorf("expected 1 flush, got %d", w.flushes)
+	}
+}
+
+func TestAfdataHandlerSyncOffByDefault(t *testing.T) {
+	w := &syncCountingWriter{}
+	logger := slog.New(NewAfdataHandler(w, FormatJson))
+	logger.Info("one")
+	if w.syncs != 0 {
+		t.Errorf("expected no syncs by default, got %d", w.syncs)
+	}
+}
+
+// blockingWriter blocks every Write until release is closed.
+type blockingWriter struct {
+	release chan struct{}
+	mu      sync.Mutex
+	lines   int
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.release
+	w.mu.Lock()
+	w.lines++
+	w.mu.Unlock()
+	return len(p), nil
+}
+
+func TestAfdataHandlerNonBlockingDropsWhenFull(t *testing.T) {
+	w := &blockingWriter{release: make(chan struct{})}
+	h := NewAfdataHandler(w, FormatJson).WithNonBlocking(1)
+	logger := slog.New(h)
+	const total = 10
+	for i := 0; i < total; i++ {
+		logger.Info("burst", "i", i)
+	}
+	// One line may be held by the writer goroutine and one queued.
+	dropped := h.DroppedCount()
+	if dropped < total-2 {
+		t.Errorf("expected at least %d drops, got %d", total-2, dropped)
+	}
+	close(w.release)
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if int64(w.lines)+h.DroppedCount() != total {
+		t.Errorf("written %d + dropped %d != %d", w.lines, h.DroppedCount(), total)
+	}
+}
+
+func TestAfdataHandlerNonBlockingWritesAllWhenNotFull(t *testing.T) {
+	var buf syncCountingWriter
+	h := NewAfdataHandler(&buf, FormatPlain).WithSyncEachWrite(true).WithNonBlocking(16)
+	logger := slog.New(h.WithAttrs([]slog.Attr{slog.String("span", "s")}))
+	logger.Info("one")
+	logger.Info("two")
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(buf.String(), "\n"); got != 2 || h.DroppedCount() != 0 {
+		t.Errorf("expected 2 lines and no drops, got %d lines, %d drops", got, h.DroppedCount())
+	}
+	if buf.syncs != 2 {
+		t.Errorf("expected 2 syncs, got %d", buf.syncs)
+	}
+	// After Close, records are written synchronously.
+	logger.Info("three")
+	if !strings.Contains(buf.String(), "message=three") {
+		t.Errorf("expected synchronous write after Close, got: %s", buf.String())
+	}
+}
+
+func TestAfdataHandlerDroppedCountZeroByDefault(t *testing.T) {
+	if got := NewAfdataHandler(&bytes.Buffer{}, FormatJson).DroppedCount(); got != 0 {
+		t.Errorf("DroppedCount() = %d, want 0", got)
+	}
+}
+
+func setClockForTest(t *testing.T, at time.Time) {
+	t.Helper()
+	SetClock(func() time.Time { return at })
+	t.Cleanup(func() { SetClock(nil) })
+}
+
+func TestAfdataHandlerZeroRecordTimeUsesClock(t *testing.T) {
+	at := time.UnixMilli(1738886400000)
+	setClockForTest(t, at)
+	var buf bytes.Buffer
+	h := NewAfdataHandler(&buf, FormatJson)
+	if err := h.Handle(context.Background(), slog.NewRecord(time.Time{}, slog.LevelInfo, "no time", 0)); err != nil {
+		t.Fatal(err)
+	}
+	m := parseJSONLine(t, &buf)
+	if m["timestamp_epoch_ms"] != float64(1738886400000) {
+		t.Errorf("timestamp_epoch_ms = %v, want clock time", m["timestamp_epoch_ms"])
+	}
+}
+
+func TestAfdataHandlerHumanTimestampJson(t *testing.T) {
+	rec := slog.NewRecord(time.UnixMilli(1738886400123), slog.LevelInfo, "ready", 0)
+	var buf bytes.Buffer
+	if err := NewAfdataHandler(&buf, FormatJson).Handle(context.Background(), rec); err != nil {
+		t.Fatal(err)
+	}
+	m := parseJSONLine(t, &buf)
+	if _, ok := m["timestamp_rfc3339"]; ok {
+		t.Errorf("timestamp_rfc3339 should be off by default: %v", m)
+	}
+
+	if err := NewAfdataHandler(&buf, FormatJson).WithHumanTimestamp(true).Handle(context.Background(), rec); err != nil {
+		t.Fatal(err)
+	}
+	m = parseJSONLine(t, &buf)
+	if m["timestamp_rfc3339"] != "2025-02-07T00:00:00.123Z" || m["timestamp_epoch_ms"] != float64(1738886400123) {
+		t.Errorf("want both timestamps, got %v", m)
+	}
+}
+
+func TestAfdataHandlerHumanTimestampPlainAndYaml(t *testing.T) {
+	rec := slog.NewRecord(time.UnixMilli(1738886400123), slog.LevelInfo, "ready", 0)
+	for _, format := range []LogFormat{FormatPlain, FormatYaml} {
+		var off, on bytes.Buffer
+		if err := NewAfdataHandler(&off, format).Handle(context.Background(), rec); err != nil {
+			t.Fatal(err)
+		}
+		if err := NewAfdataHandler(&on, format).WithHumanTimestamp(true).Handle(context.Background(), rec); err != nil {
+			t.Fatal(err)
+		}
+		assertContains(t, on.String(), "2025-02-07T00:00:00.123Z")
+		assertNotContains(t, on.String(), "timestamp_")
+		assertEqual(t, on.String(), off.String())
+	}
+}
+
+func TestAfdataHandlerHumanTimestampCoalesce(t *testing.T) {
+	clock := time.UnixMilli(1738886400000)
+	setClockForTest(t, clock)
+	var buf bytes.Buffer
+	h := NewAfdataHandler(&buf, FormatJson).WithHumanTimestamp(true).WithCoalesce(true)
+	logger := slog.New(h)
+	logger.Info("tick")
+	setClockForTest(t, clock.Add(time.Second))
+	logger.Info("tick")
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	lines := jsonLines(t, &buf)
+	if len(lines) != 2 || lines[1]["repeated"] != float64(1) || lines[1]["timestamp_rfc3339"] != "2025-02-07T00:00:01.000Z" {
+		t.Errorf("want line plus repeat summary with readable time, got %v", lines)
+	}
+}
+
+func TestAfdataHandlerCoalesceSummaryUsesClock(t *testing.T) {
+	setClockForTest(t, time.UnixMilli(1738886400000))
+	var buf bytes.Buffer
+	h := NewAfdataHandler(&buf, FormatPlain).WithCoalesce(true)
+	logger := slog.New(h)
+	logger.Info("tick")
+	logger.Info("tick")
+	buf.Reset()
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := `code=info message="(repeated 1 times)" repeated=1 timestamp=2025-02-07T00:00:00.000Z` + "\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestAfdataHandlerSecretSpanAttrRedactedAllFormats(t *testing.T) {
+	for _, format := range []LogFormat{FormatJson, FormatPlain, FormatYaml} {
+		var buf bytes.Buffer
+		logger := slog.New(NewAfdataHandler(&buf, format)).With(
+			"api_key_secret", "sk-live-123",
+			"creds_secret", map[string]any{"token_secret": "tok-1", "user": "alice"},
+		)
+		logger.Info("span secret")
+		out := buf.String()
+		if strings.Contains(out, "sk-live-123") || strings.Contains(out, "tok-1") {
+			t.Errorf("format %d: secret leaked: %s", format, out)
+		}
+		// JSON keeps non-secret leaves of secret containers; YAML/plain mask the whole field.
+		if format == FormatJson && !strings.Contains(out, "alice") {
+			t.Errorf("non-secret leaf under secret container should be kept: %s", out)
+		}
+	}
+}
+
+func TestAfdataHandlerWithAttrsDoesNotRetainSecret(t *testing.T) {
+	h := NewAfdataHandler(&bytes.Buffer{}, FormatJson).WithAttrs([]slog.Attr{slog.String("api_key_secret", "sk-live-123")})
+	for _, a := range h.(*AfdataHandler).attrs {
+		if strings.Contains(a.Value.String(), "sk-live-123") {
+			t.Errorf("handler retained secret span attr %s", a)
+		}
+	}
+}
+
+func TestAfdataHandlerWithAttrsDoesNotRetainNestedSecret(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewAfdataHandler(&buf, FormatJson).WithAttrs([]slog.Attr{
+		slog.Group("db", slog.String("password_secret", "hunter2"), slog.String("host", "db1")),
+		slog.Any("cfg", map[string]any{"auth": map[string]any{"token_secret": "sk-live-123"}}),
+	})
+	for _, a := range h.(*AfdataHandler).attrs {
+		if s := a.Value.String(); strings.Contains(s, "hunter2") || strings.Contains(s, "sk-live-123") {
+			t.Errorf("handler retained nested secret in %s: %s", a.Key, s)
+		}
+	}
+	slog.New(h).Info("q")
+	m := parseJSONLine(t, &buf)
+	if db := m["db"].(map[string]any); db["password_secret"] != "***" || db["host"] != "db1" {
+		t.Errorf("db = %v", db)
+	}
+}
+
+func TestAfdataHandlerWithMessageKey(t *testing.T) {
+	var buf bytes.Buffer
+	slog.New(NewAfdataHandler(&buf, FormatJson).WithMessageKey("msg")).Info("hello", "latency_ms", 5)
+	m := parseJSONLine(t, &buf)
+	if m["msg"] != "hello" {
+		t.Errorf("msg = %v, want hello", m["msg"])
+	}
+	if _, ok := m["message"]; ok {
+		t.Error("message key should be absent")
+	}
+
+	slog.New(NewAfdataHandler(&buf, FormatYaml).WithMessageKey("msg")).Info("hello")
+	out := buf.String()
+	if !strings.Contains(out, `msg: "hello"`) || strings.Contains(out, "message:") {
+		t.Errorf("expected msg key in YAML, got: %s", out)
+	}
+}
+
+func TestAfdataHandlerOmitEmptyMessage(t *testing.T) {
+	var buf bytes.Buffer
+	slog.New(NewAfdataHandler(&buf, FormatJson)).Info("", "user_id", 7)
+	m := parseJSONLine(t, &buf)
+	if msg, ok := m["message"]; !ok || msg != "" {
+		t.Errorf("default should keep empty message, got %v", m)
+	}
+
+	logger := slog.New(NewAfdataHandler(&buf, FormatJson).WithOmitEmptyMessage(true))
+	logger.Info("", "user_id", 7)
+	m = parseJSONLine(t, &buf)
+	if _, ok := m["message"]; ok {
+		t.Errorf("empty message should be omitted, got %v", m)
+	}
+	if m["user_id"] != float64(7) || m["code"] != "info" {
+		t.Errorf("other fields should remain, got %v", m)
+	}
+
+	logger.Info("hello")
+	m = parseJSONLine(t, &buf)
+	if m["message"] != "hello" {
+		t.Errorf("non-empty message should be kept, got %v", m)
+	}
+}
+
+func TestAfdataHandlerWithErrorEnvelope(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewAfdataHandler(&buf, FormatJson).WithErrorEnvelope(true))
+	logger.Error("user not found", "code", "not_found", "user_id", 7)
+	m := parseJSONLine(t, &buf)
+	if m["error"] != "user not found" || m["code"] != "error" {
+		t.Errorf("expected error envelope, got %v", m)
+	}
+	if _, ok := m["message"]; ok {
+		t.Error("message should be absent for error-level records")
+	}
+
+	logger.Warn("slow")
+	m = parseJSONLine(t, &buf)
+	if m["message"] != "slow" || m["code"] != "warn" {
+		t.Errorf("non-error records keep message, got %v", m)
+	}
+}
+
+func TestAfdataHandlerErrorEnvelopeWinsOverEventAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewAfdataHandler(&buf, FormatJson).WithErrorEnvelope(true))
+	logger.Error("write failed", "error", errors.New("disk full"), "code", "io")
+	m := parseJSONLine(t, &buf)
+	if m["error"] != "write failed" || m["code"] != "error" {
+		t.Errorf("event attrs clobbered the envelope: %v", m)
+	}
+}
+
+func TestAfdataHandlerErrorEnvelopeWinsOverSpanAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewAfdataHandler(&buf, FormatJson).WithErrorEnvelope(true).WithAttrs([]slog.Attr{slog.String("error", "stale")})
+	slog.New(h).Error("write failed")
+	m := parseJSONLine(t, &buf)
+	if m["error"] != "write failed" || m["code"] != "error" {
+		t.Errorf("span attrs clobbered the envelope: %v", m)
+	}
+}
+
+func TestAfdataHandlerErrorEnvelopeOffByDefault(t *testing.T) {
+	var buf bytes.Buffer
+	slog.New(NewAfdataHandler(&buf, FormatJson)).Error("boom")
+	m := parseJSONLine(t, &buf)
+	if m["message"] != "boom" {
+		t.Errorf("message = %v, want boom", m["message"])
+	}
+	if _, ok := m["error"]; ok {
+		t.Error("error key should be absent by default")
+	}
+}
+
+func TestAfdataHandlerWithCodeRouter(t *testing.T) {
+	var infoBuf, errBuf bytes.Buffer
+	h := NewAfdataHandler(&infoBuf, FormatJson).WithCodeRouter(func(code string) io.Writer {
+		if code == "error" {
+			return &errBuf
+		}
+		return nil
+	})
+	logger := slog.New(h)
+	logger.Info("started")
+	logger.Error("failed")
+	logger.Info("custom", "code", "error")
+
+	if got := strings.Count(infoBuf.String(), "\n"); got != 1 || !strings.Contains(infoBuf.String(), `"message":"started"`) {
+		t.Errorf("info writer: expected only the started line, got: %s", infoBuf.String())
+	}
+	lines := jsonLines(t, &errBuf)
+	if len(lines) != 2 || lines[0]["message"] != "failed" || lines[1]["message"] != "custom" {
+		t.Errorf("error writer: expected failed and custom lines, got: %s", errBuf.String())
+	}
+}
+
+func TestAfdataHandlerCodeRouterNonBlocking(t *testing.T) {
+	var infoBuf, errBuf bytes.Buffer
+	h := NewAfdataHandler(&infoBuf, FormatPlain).WithCodeRouter(func(code string) io.Writer {
+		if code == "error" {
+			return &errBuf
+		}
+		return &infoBuf
+	}).WithNonBlocking(8)
+	logger := slog.New(h)
+	logger.Info("one")
+	logger.Error("two")
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(infoBuf.String(), "message=one") || strings.Contains(infoBuf.String(), "two") {
+		t.Errorf("info writer: %s", infoBuf.String())
+	}
+	if !strings.Contains(errBuf.String(), "message=two") {
+		t.Errorf("error writer: %s", errBuf.String())
+	}
+}
+
+func TestAfdataHandlerDuplicateKeysOverrideOrder(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewAfdataHandler(&buf, FormatJson)
+	logger := slog.New(h.WithAttrs([]slog.Attr{slog.String("step", "a"), slog.String("step", "b"), slog.String("req", "r1")})).
+		With("step", "c").
+		With("step", "d", "user", "u1")
+	if got := len(logger.Handler().(*AfdataHandler).attrs); got != 3 {
+		t.Errorf("expected 3 span attrs after dedup, got %d", got)
+	}
+
+	logger.Info("span only")
+	m := parseJSONLine(t, &buf)
+	if m["step"] != "d" || m["req"] != "r1" || m["user"] != "u1" {
+		t.Errorf("latest span attr should win, got %v", m)
+	}
+
+	logger.Info("event wins", "step", "e1", "step", "e2")
+	m = parseJSONLine(t, &buf)
+	if m["step"] != "e2" {
+		t.Errorf("last event attr should win over span attrs, got %v", m["step"])
+	}
+}
+
+func TestWithSpanNestedOverridesOuter(t *testing.T) {
+	var buf bytes.Buffer
+	setDefaultLoggerForTest(t, slog.New(NewAfdataHandler(&buf, FormatJson)))
+	ctx := WithSpan(context.Background(), map[string]any{"request_id": "outer", "tenant": "t1"})
+	ctx = WithSpan(ctx, map[string]any{"request_id": "inner"})
+	LoggerFromContext(ctx).Info("nested")
+	m := parseJSONLine(t, &buf)
+	if m["request_id"] != "inner" || m["tenant"] != "t1" {
+		t.Errorf("inner span should override outer, got %v", m)
+	}
+	LoggerFromContext(ctx).Info("event", "request_id", "event")
+	m = parseJSONLine(t, &buf)
+	if m["request_id"] != "event" {
+		t.Errorf("event attr should override span, got %v", m["request_id"])
+	}
+}
+
+func TestWithSpanInsideGroupLogsFieldsOnce(t *testing.T) {
+	var buf bytes.Buffer
+	setDefaultLoggerForTest(t, slog.New(NewAfdataHandler(&buf, FormatJson).WithGroup("db")))
+	ctx := WithSpan(context.Background(), map[string]any{"request_id": "r1"})
+	logger := LoggerFromContext(ctx)
+
+	for _, log := range []func(){
+		func() { logger.InfoContext(ctx, "query", "rows", 2) },
+		func() { logger.Info("query", "rows", 2) },
+	} {
+		log()
+		m := parseJSONLine(t, &buf)
+		if m["request_id"] != "r1" {
+			t.Errorf("request_id = %v, want r1 at the top level", m["request_id"])
+		}
+		db, _ := m["db"].(map[string]any)
+		if _, dup := db["request_id"]; dup || db["rows"] == nil {
+			t.Errorf("db = %v, want only the event fields", db)
+		}
+	}
+}
+
+func TestWithSpanForeignHandlerUsesWithAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	setDefaultLoggerForTest(t, slog.New(slog.NewJSONHandler(&buf, nil)))
+	ctx := WithSpan(context.Background(), map[string]any{"request_id": "r1"})
+	LoggerFromContext(ctx).Info("hello")
+	m := parseJSONLine(t, &buf)
+	if m["request_id"] != "r1" {
+		t.Errorf("request_id = %v, want r1", m["request_id"])
+	}
+}
+
+func TestAfdataHandlerDefaultLevelSuppressesDebug(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewAfdataHandler(&buf, FormatJson))
+	logger.Debug("hidden")
+	logger.Info("shown")
+	lines := jsonLines(t, &buf)
+	if len(lines) != 1 || lines[0]["message"] != "shown" {
+		t.Errorf("expected only the info record, got: %s", buf.String())
+	}
+}
+
+func TestAfdataHandlerWithLevelerLevelVar(t *testing.T) {
+	var buf bytes.Buffer
+	var level slog.LevelVar
+	level.Set(slog.LevelInfo)
+	logger := slog.New(NewAfdataHandlerWithLeveler(&buf, FormatJson, &level))
+	logger.Debug("hidden")
+	level.Set(slog.LevelDebug)
+	logger.Debug("shown")
+	level.Set(slog.LevelWarn)
+	logger.Info("hidden again")
+
+	lines := jsonLines(t, &buf)
+	if len(lines) != 1 || lines[0]["message"] != "shown" || lines[0]["code"] != "debug" {
+		t.Errorf("expected only the debug record logged while enabled, got: %s", buf.String())
+	}
+}
+
+func TestAfdataHandlerWithLevelerNilDefaultsToInfo(t *testing.T) {
+	h := NewAfdataHandlerWithLeveler(&bytes.Buffer{}, FormatJson, nil)
+	if h.Enabled(context.Background(), slog.LevelDebug) || !h.Enabled(context.Background(), slog.LevelInfo) {
+		t.Error("nil level should behave as slog.LevelInfo")
+	}
+}
+
+func TestAfdataHandlerWithCodeFilter(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewAfdataHandler(&buf, FormatJson).WithCodeFilter([]string{" Error ", "startup"}))
+	logger.Info("dropped")
+	logger.Error("kept")
+	logger.Info("service up", "code", "startup")
+	logger.Error("overridden", "code", "retry")
+
+	lines := jsonLines(t, &buf)
+	if len(lines) != 2 || lines[0]["message"] != "kept" || lines[1]["message"] != "service up" {
+		t.Errorf("expected only error and startup records, got: %s", buf.String())
+	}
+}
+
+func TestAfdataHandlerCodeFilterEmptyDisables(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewAfdataHandler(&buf, FormatJson).WithCodeFilter([]string{"error"}).WithCodeFilter(nil))
+	logger.Info("kept")
+	if !strings.Contains(buf.String(), `"message":"kept"`) {
+		t.Errorf("empty filter should keep all records, got: %s", buf.String())
+	}
+}
+
+// chunkWriter records each Write call separately.
+type chunkWriter struct {
+	mu     sync.Mutex
+	chunks []string
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.chunks = append(w.chunks, string(p))
+	return len(p), nil
+}
+
+func (w *chunkWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return strings.Join(w.chunks, "")
+}
+
+func TestAfdataHandlerWithBufferHoldsUntilFlush(t *testing.T) {
+	var w chunkWriter
+	h := NewAfdataHandler(&w, FormatJson).WithBuffer(4096)
+	logger := slog.New(h)
+	logger.Info("one")
+	logger.Info("two")
+	if len(w.chunks) != 0 {
+		t.Fatalf("expected nothing written before Flush, got %q", w.chunks)
+	}
+	if err := h.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.chunks) != 1 || strings.Count(w.chunks[0], "\n") != 2 {
+		t.Errorf("expected one write with two lines, got %q", w.chunks)
+	}
+	if !strings.Contains(w.chunks[0], `"message":"one"`) || strings.Index(w.chunks[0], "one") > strings.Index(w.chunks[0], "two") {
+		t.Errorf("lines out of order: %q", w.chunks[0])
+	}
+}
+
+func TestAfdataHandlerWithBufferAutoFlushKeepsLinesWhole(t *testing.T) {
+	var w chunkWriter
+	h := NewAfdataHandler(&w, FormatPlain).WithBuffer(256)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			logger := slog.New(h.WithAttrs([]slog.Attr{slog.Int("worker", g)}))
+			for i := 0; i < 50; i++ {
+				logger.Info("tick", "seq", i)
+			}
+		}(g)
+	}
+	wg.Wait()
+	if len(w.chunks) < 2 {
+		t.Errorf("expected the size threshold to trigger writes, got %d", len(w.chunks))
+	}
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range w.chunks {
+		if !strings.HasSuffix(c, "\n") {
+			t.Fatalf("write ended mid-line: %q", c)
+		}
+	}
+	lines := strings.Split(strings.TrimSuffix(w.String(), "\n"), "\n")
+	if len(lines) != 400 {
+		t.Fatalf("expected 400 lines, got %d", len(lines))
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "code=info message=tick seq=") {
+			t.Fatalf("interleaved or partial line: %q", line)
+		}
+	}
+}
+
+func TestAfdataHandlerWithBufferNonBlocking(t *testing.T) {
+	var w chunkWriter
+	h := NewAfdataHandler(&w, FormatJson).WithBuffer(4096).WithNonBlocking(16)
+	slog.New(h).Info("queued")
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(w.String(), `"message":"queued"`) {
+		t.Errorf("Close should drain the queue and flush the buffer, got %q", w.String())
+	}
+}
+
+func TestAfdataHandlerFlushWithoutBuffer(t *testing.T) {
+	if err := NewAfdataHandler(&bytes.Buffer{}, FormatJson).Flush(); err != nil {
+		t.Errorf("Flush without buffer = %v, want nil", err)
+	}
+}
+
+// fileHandlerBenchmark logs to a real file, where each unbuffered record
+// costs a write syscall.
+func fileHandlerBenchmark(b *testing.B, buffered bool) {
+	f, err := os.Create(filepath.Join(b.TempDir(), "log.jsonl"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+	h := NewAfdataHandler(f, FormatJson)
+	if buffered {
+		h = h.WithBuffer(64 * 1024)
+	}
+	logger := slog.New(h)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.Info("request", "latency_ms", i)
+	}
+	if err := h.Close(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func BenchmarkAfdataHandlerUnbuffered(b *testing.B) { fileHandlerBenchmark(b, false) }
+
+func BenchmarkAfdataHandlerBuffered(b *testing.B) { fileHandlerBenchmark(b, true) }
+
+func TestAfdataHandlerSpanFieldsFromContext(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewAfdataHandler(&buf, FormatJson))
+	ctx := WithSpan(context.Background(), map[string]any{"request_id": "r1", "step": "span", "api_key_secret": "sk-1"})
+	ctx = WithSpan(ctx, map[string]any{"tenant": "t1"})
+
+	logger.InfoContext(ctx, "via InfoContext", "step", "event")
+	m := parseJSONLine(t, &buf)
+	if m["request_id"] != "r1" || m["tenant"] != "t1" {
+		t.Errorf("span fields missing: %v", m)
+	}
+	if m["step"] != "event" {
+		t.Errorf("event attr should override span field, got %v", m["step"])
+	}
+	if m["api_key_secret"] != "***" {
+		t.Errorf("span secret not redacted: %v", m["api_key_secret"])
+	}
+
+	logger.Info("no context")
+	m = parseJSONLine(t, &buf)
+	if _, ok := m["request_id"]; ok {
+		t.Errorf("span fields leaked without context: %v", m)
+	}
+}
+
+type requestIDKey struct{}
+
+func TestAfdataHandlerRegisteredContextField(t *testing.T) {
+	RegisterContextField(requestIDKey{}, "request_id")
+	t.Cleanup(func() { RegisterContextField(requestIDKey{}, "") })
+
+	var buf bytes.Buffer
+	logger := slog.New(NewAfdataHandler(&buf, FormatJson))
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "req-42")
+
+	logger.InfoContext(ctx, "handled")
+	m := parseJSONLine(t, &buf)
+	if m["request_id"] != "req-42" {
+		t.Errorf("request_id = %v, want req-42", m["request_id"])
+	}
+
+	logger.InfoContext(ctx, "override", "request_id", "event")
+	if m = parseJSONLine(t, &buf); m["request_id"] != "event" {
+		t.Errorf("event attr should override context field, got %v", m["request_id"])
+	}
+
+	logger.InfoContext(context.Background(), "no value")
+	if m = parseJSONLine(t, &buf); m["request_id"] != nil {
+		t.Errorf("absent context value should be skipped: %v", m)
+	}
+
+	RegisterContextField(requestIDKey{}, "rid")
+	logger.InfoContext(ctx, "renamed")
+	if m = parseJSONLine(t, &buf); m["rid"] != "req-42" || m["request_id"] != nil {
+		t.Errorf("re-registering should rename the field: %v", m)
+	}
+}
+
+func TestAfdataHandlerWithGroupNestsJson(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewAfdataHandler(&buf, FormatJson)).With("request_id", "r1")
+	logger.WithGroup("db").With("table", "users").Info("query", "query_ms", 5, "code", "slow")
+	m := parseJSONLine(t, &buf)
+
+	db, ok := m["db"].(map[string]any)
+	if !ok {
+		t.Fatalf("db = %#v, want nested map", m["db"])
+	}
+	if db["table"] != "users" || db["query_ms"] != float64(5) || db["code"] != "slow" {
+		t.Errorf("db = %v, want table, query_ms and code nested", db)
+	}
+	if m["request_id"] != "r1" || m["code"] != "info" || m["message"] != "query" {
+		t.Errorf("top-level fields wrong: %v", m)
+	}
+}
+
+func TestAfdataHandlerWithGroupPlainDotted(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewAfdataHandler(&buf, FormatPlain))
+	logger.WithGroup("db").Info("query", "query_ms", 5, "password_secret", "hunter2")
+	line := buf.String()
+	assertContains(t, line, "db.query=5ms")
+	assertContains(t, line, "db.password=***")
+	assertNotContains(t, line, "hunter2")
+}
+
+func TestAfdataHandlerNestedGroupsCompose(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewAfdataHandler(&buf, FormatJson))
+	logger.WithGroup("db").With("pool", "main").WithGroup("tx").Info("commit", "rows", 3)
+	m := parseJSONLine(t, &buf)
+
+	db, _ := m["db"].(map[string]any)
+	tx, _ := db["tx"].(map[string]any)
+	if db["pool"] != "main" || tx["rows"] != float64(3) {
+		t.Errorf("nested groups = %v, want db.pool and db.tx.rows", m)
+	}
+}
+
+func TestAfdataHandlerEmptyGroupOmitted(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewAfdataHandler(&buf, FormatJson))
+	logger.WithGroup("db").WithGroup("tx").Info("idle")
+	m := parseJSONLine(t, &buf)
+	if _, ok := m["db"]; ok {
+		t.Errorf("empty group should be omitted: %v", m)
+	}
+
+	buf.Reset()
+	logger.WithGroup("").Info("flat", "rows", 1)
+	m = parseJSONLine(t, &buf)
+	if m["rows"] != float64(1) {
+		t.Errorf("empty group name should not nest: %v", m)
+	}
+}
+
+func TestAfdataHandlerEcsFormat(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewAfdataHandler(&buf, FormatEcs)).With("request_id", "r1")
+	h := logger.Handler()
+	rec := slog.NewRecord(time.UnixMilli(1738886400123), slog.LevelWarn, "slow query", 0)
+	rec.AddAttrs(slog.Int("latency_ms", 1500), slog.String("api_key_secret", "sk-live-123"))
+	if err := h.Handle(context.Background(), rec); err != nil {
+		t.Fatal(err)
+	}
+	line := buf.String()
+	m := parseJSONLine(t, &buf)
+
+	if m["@timestamp"] != "2025-02-07T00:00:00.123Z" {
+		t.Errorf("@timestamp = %v", m["@timestamp"])
+	}
+	if lg, _ := m["log"].(map[string]any); lg["level"] != "warn" {
+		t.Errorf("log.level = %v, want warn", m["log"])
+	}
+	if m["message"] != "slow query" {
+		t.Errorf("message = %v, want slow query", m["message"])
+	}
+	if ecs, _ := m["ecs"].(map[string]any); ecs["version"] != ecsVersion {
+		t.Errorf("ecs.version = %v", m["ecs"])
+	}
+	payload, ok := m["afdata"].(map[string]any)
+	if !ok {
+		t.Fatalf("afdata namespace missing: %v", m)
+	}
+	if payload["request_id"] != "r1" || payload["latency_ms"] != float64(1500) || payload["code"] != "warn" {
+		t.Errorf("custom attrs not preserved under afdata: %v", payload)
+	}
+	for _, k := range []string{"timestamp_epoch_ms", "message", "__level"} {
+		if _, ok := payload[k]; ok {
+			t.Errorf("afdata should not repeat %s: %v", k, payload)
+		}
+	}
+	if payload["api_key_secret"] != "***" || strings.Contains(line, "sk-live-123") {
+		t.Errorf("secret not redacted: %s", line)
+	}
+}
+
+func TestAfdataHandlerEcsKeepsLevelWithCodeOverride(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewAfdataHandler(&buf, FormatEcs).WithMessageKey("msg"))
+	logger.Info("Server ready", "code", "log", "event", "startup")
+	m := parseJSONLine(t, &buf)
+	if lg, _ := m["log"].(map[string]any); lg["level"] != "info" {
+		t.Errorf("log.level = %v, want info", m["log"])
+	}
+	if m["message"] != "Server ready" {
+		t.Errorf("ECS message should come from the message key: %v", m)
+	}
+	if payload, _ := m["afdata"].(map[string]any); payload["code"] != "log" || payload["event"] != "startup" {
+		t.Errorf("afdata = %v, want code log and event startup", payload)
+	}
+}
+
+func TestAfdataHandlerEcsLevelIgnoresLevelLikeAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	slog.New(NewAfdataHandler(&buf, FormatEcs)).Error("boom", "__level", "debug", "level", "info")
+	m := parseJSONLine(t, &buf)
+	if lg, _ := m["log"].(map[string]any); lg["level"] != "error" {
+		t.Errorf("log.level = %v, want error", m["log"])
+	}
+}
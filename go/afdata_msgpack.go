@@ -0,0 +1,186 @@
+package afdata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// ═══════════════════════════════════════════
+// Public API: MessagePack Output
+// ═══════════════════════════════════════════
+
+// OutputMsgpack encodes value as MessagePack for binary transports. The
+// value goes through the same preparation as OutputJson (secrets redacted,
+// original keys, raw values, map keys in JCS order), except that integers
+// keep full 64-bit precision: int64(9007199254740993) stays an integer
+// rather than becoming a float. Output hooks do not apply.
+func OutputMsgpack(value any) ([]byte, error) {
+	return appendMsgpack(nil, InternalRedactedCopy(value))
+}
+
+// sanitizeMsgpackLeaf is sanitizeJSONLeaf without the float64 round trip:
+// integer kinds are kept, and other values decode their JSON form with
+// json.Number so integer fields of structs stay exact too.
+func sanitizeMsgpackLeaf(value any) any {
+	switch v := value.(type) {
+	case nil, string, float64, bool, json.Number:
+		return value
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	case uint:
+		return uint64(v)
+	case uint8:
+		return uint64(v)
+	case uint16:
+		return uint64(v)
+	case uint32:
+		return uint64(v)
+	case uint64:
+		return v
+	case []byte:
+		return formatByteSlice(v)
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		// Never stringify raw value content here; it may contain secrets.
+		return fmt.Sprintf("<unsupported:%T>", value)
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var result any
+	if err := dec.Decode(&result); err != nil {
+		return fmt.Sprintf("<unsupported:%T>", value)
+	}
+	return result
+}
+
+func appendMsgpack(b []byte, value any) ([]byte, error) {
+	var err error
+	switch v := value.(type) {
+	case nil:
+		return append(b, 0xc0), nil
+	case bool:
+		if v {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+	case int64:
+		return appendMsgpackInt(b, v), nil
+	case uint64:
+		return appendMsgpackUint(b, v), nil
+	case float64:
+		return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(v)), nil
+	case json.Number:
+		return appendMsgpackNumber(b, v), nil
+	case string:
+		return appendMsgpackString(b, v), nil
+	case RawString:
+		return appendMsgpackString(b, string(v)), nil
+	case []any:
+		b = appendMsgpackHeader(b, len(v), 0x90, 0xdc, 0xdd)
+		for _, item := range v {
+			if b, err = appendMsgpack(b, item); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case map[string]any:
+		b = appendMsgpackHeader(b, len(v), 0x80, 0xde, 0xdf)
+		for _, k := range sortedKeys(v) {
+			b = appendMsgpackString(b, k)
+			if b, err = appendMsgpack(b, v[k]); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("msgpack: unsupported type %T", value)
+}
+
+// appendMsgpackInt writes n in the smallest integer encoding; non-negative
+// values use the unsigned forms.
+func appendMsgpackInt(b []byte, n int64) []byte {
+	switch {
+	case n >= 0:
+		return appendMsgpackUint(b, uint64(n))
+	case n >= -32:
+		return append(b, byte(n))
+	case n >= math.MinInt8:
+		return append(b, 0xd0, byte(n))
+	case n >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(n))
+	case n >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(n))
+	}
+}
+
+func appendMsgpackUint(b []byte, n uint64) []byte {
+	switch {
+	case n <= 0x7f:
+		return append(b, byte(n))
+	case n <= math.MaxUint8:
+		return append(b, 0xcc, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xcf), n)
+	}
+}
+
+// appendMsgpackNumber writes a json.Number as an integer when it is one
+// exactly, else as a float; a number beyond float64 range stays a string.
+func appendMsgpackNumber(b []byte, n json.Number) []byte {
+	if i, err := n.Int64(); err == nil {
+		return appendMsgpackInt(b, i)
+	}
+	if u, err := strconv.ParseUint(n.String(), 10, 64); err == nil {
+		return appendMsgpackUint(b, u)
+	}
+	if f, err := n.Float64(); err == nil {
+		return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(f))
+	}
+	return appendMsgpackString(b, n.String())
+}
+
+func appendMsgpackString(b []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, s...)
+}
+
+// appendMsgpackHeader writes an array or map length: the fix form (up to
+// 15 entries) or the 16/32-bit form.
+func appendMsgpackHeader(b []byte, n int, fix, code16, code32 byte) []byte {
+	switch {
+	case n < 16:
+		return append(b, fix|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, code16), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, code32), uint32(n))
+	}
+}
@@ -0,0 +1,224 @@
+package afdata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// decodeMsgpack is a minimal decoder for the subset OutputMsgpack emits.
+// Integers decode to int64 (uint64 above MaxInt64), floats to float64.
+func decodeMsgpack(t *testing.T, b []byte) any {
+	t.Helper()
+	v, rest, err := readMsgpack(b)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(rest) != 0 {
+		t.Fatalf("decode: %d trailing bytes", len(rest))
+	}
+	return v
+}
+
+func readMsgpack(b []byte) (any, []byte, error) {
+	if len(b) == 0 {
+		return nil, nil, fmt.Errorf("unexpected end")
+	}
+	c, b := b[0], b[1:]
+	be := binary.BigEndian
+	switch {
+	case c <= 0x7f:
+		return int64(c), b, nil
+	case c >= 0xe0:
+		return int64(int8(c)), b, nil
+	case c&0xe0 == 0xa0:
+		return readMsgpackStr(b, int(c&0x1f))
+	case c&0xf0 == 0x90:
+		return readMsgpackArray(b, int(c&0x0f))
+	case c&0xf0 == 0x80:
+		return readMsgpackMap(b, int(c&0x0f))
+	}
+	switch c {
+	case 0xc0:
+		return nil, b, nil
+	case 0xc2:
+		return false, b, nil
+	case 0xc3:
+		return true, b, nil
+	case 0xcb:
+		return math.Float64frombits(be.Uint64(b)), b[8:], nil
+	case 0xcc:
+		return int64(b[0]), b[1:], nil
+	case 0xcd:
+		return int64(be.Uint16(b)), b[2:], nil
+	case 0xce:
+		return int64(be.Uint32(b)), b[4:], nil
+	case 0xcf:
+		if u := be.Uint64(b); u > math.MaxInt64 {
+			return u, b[8:], nil
+		}
+		return int64(be.Uint64(b)), b[8:], nil
+	case 0xd0:
+		return int64(int8(b[0])), b[1:], nil
+	case 0xd1:
+		return int64(int16(be.Uint16(b))), b[2:], nil
+	case 0xd2:
+		return int64(int32(be.Uint32(b))), b[4:], nil
+	case 0xd3:
+		return int64(be.Uint64(b)), b[8:], nil
+	case 0xd9:
+		return readMsgpackStr(b[1:], int(b[0]))
+	case 0xda:
+		return readMsgpackStr(b[2:], int(be.Uint16(b)))
+	case 0xdb:
+		return readMsgpackStr(b[4:], int(be.Uint32(b)))
+	case 0xdc:
+		return readMsgpackArray(b[2:], int(be.Uint16(b)))
+	case 0xde:
+		return readMsgpackMap(b[2:], int(be.Uint16(b)))
+	}
+	return nil, nil, fmt.Errorf("unsupported code 0x%02x", c)
+}
+
+func readMsgpackStr(b []byte, n int) (any, []byte, error) {
+	return string(b[:n]), b[n:], nil
+}
+
+func readMsgpackArray(b []byte, n int) (any, []byte, error) {
+	out := make([]any, n)
+	var err error
+	for i := range out {
+		if out[i], b, err = readMsgpack(b); err != nil {
+			return nil, nil, err
+		}
+	}
+	return out, b, nil
+}
+
+func readMsgpackMap(b []byte, n int) (any, []byte, error) {
+	out := make(map[string]any, n)
+	for i := 0; i < n; i++ {
+		k, rest, err := readMsgpack(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		var v any
+		if v, b, err = readMsgpack(rest); err != nil {
+			return nil, nil, err
+		}
+		out[k.(string)] = v
+	}
+	return out, b, nil
+}
+
+func TestOutputMsgpackRoundTrip(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	items := make([]any, 20)
+	for i := range items {
+		items[i] = i - 10
+	}
+	value := map[string]any{
+		"name":    "agent",
+		"ok":      true,
+		"missing": nil,
+		"ratio":   0.25,
+		"note":    long,
+		"items":   items,
+		"nested":  map[string]any{"depth": 2, "label": strings.Repeat("y", 40)},
+	}
+	b, err := OutputMsgpack(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"name":    "agent",
+		"ok":      true,
+		"missing": nil,
+		"ratio":   0.25,
+		"note":    long,
+		"items":   make([]any, 20),
+		"nested":  map[string]any{"depth": int64(2), "label": strings.Repeat("y", 40)},
+	}
+	for i := range items {
+		want["items"].([]any)[i] = int64(i - 10)
+	}
+	if got := decodeMsgpack(t, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip = %#v, want %#v", got, want)
+	}
+}
+
+func TestOutputMsgpackInt64Fidelity(t *testing.T) {
+	type usage struct {
+		Tokens int64 `json:"tokens"`
+	}
+	b, err := OutputMsgpack(map[string]any{
+		"big":    int64(9007199254740993),
+		"min":    int64(math.MinInt64),
+		"max":    uint64(math.MaxUint64),
+		"small":  int32(-200),
+		"number": json.Number("9007199254740995"),
+		"struct": usage{Tokens: 9007199254740997},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := decodeMsgpack(t, b).(map[string]any)
+	checks := map[string]any{
+		"big":    int64(9007199254740993),
+		"min":    int64(math.MinInt64),
+		"max":    uint64(math.MaxUint64),
+		"small":  int64(-200),
+		"number": int64(9007199254740995),
+	}
+	for k, want := range checks {
+		if got[k] != want {
+			t.Errorf("%s = %#v, want %#v", k, got[k], want)
+		}
+	}
+	if s, _ := got["struct"].(map[string]any); s["tokens"] != int64(9007199254740997) {
+		t.Errorf("struct = %#v, want exact tokens", got["struct"])
+	}
+}
+
+func TestOutputMsgpackRedactsSecrets(t *testing.T) {
+	b, err := OutputMsgpack(map[string]any{
+		"api_key_secret": "sk-live-123",
+		"pin_secret":     1234,
+		"config":         map[string]any{"db_password_secret": "hunter2", "host": "db"},
+		"__meta":         "dropped",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, []byte("sk-live-123")) || bytes.Contains(b, []byte("hunter2")) {
+		t.Fatalf("secret leaked into msgpack output: %q", b)
+	}
+	got := decodeMsgpack(t, b).(map[string]any)
+	if got["api_key_secret"] != "***" || got["pin_secret"] != "***" {
+		t.Errorf("secrets not redacted: %#v", got)
+	}
+	if cfg := got["config"].(map[string]any); cfg["db_password_secret"] != "***" || cfg["host"] != "db" {
+		t.Errorf("nested secret not redacted: %#v", cfg)
+	}
+	if _, ok := got["__meta"]; ok {
+		t.Errorf("metadata key should be dropped: %#v", got)
+	}
+}
+
+func TestOutputMsgpackCanonicalKeyOrder(t *testing.T) {
+	a, _ := OutputMsgpack(map[string]any{"b": 1, "a": 2, "c": map[string]any{"z": 1, "y": 2}})
+	b, _ := OutputMsgpack(map[string]any{"c": map[string]any{"y": 2, "z": 1}, "a": 2, "b": 1})
+	if !bytes.Equal(a, b) {
+		t.Errorf("encodings differ:\n%x\n%x", a, b)
+	}
+	// fixmap(3) "a" 2 "b" 1 "c" fixmap(2) "y" 2 "z" 1
+	want := []byte{0x83, 0xa1, 'a', 0x02, 0xa1, 'b', 0x01, 0xa1, 'c', 0x82, 0xa1, 'y', 0x02, 0xa1, 'z', 0x01}
+	if !bytes.Equal(a, want) {
+		t.Errorf("got %x, want %x", a, want)
+	}
+}
@@ -0,0 +1,485 @@
+package afdata
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ═══════════════════════════════════════════
+// Public API: Parsers
+// ═══════════════════════════════════════════
+
+// ParsePlain parses a line produced by OutputPlain back into a map.
+//
+// Tokens are split on spaces, except inside double-quoted values
+// (key="a b"). Each token splits on its first '='; "key=" yields "".
+// Dotted keys rebuild nested maps ("trace.source=db" → {trace:{source:db}}).
+// All values are strings: unit formatting is not reversed, and since
+// OutputPlain does not escape quotes, values are recovered verbatim.
+func ParsePlain(line string) (map[string]any, error) {
+	result := map[string]any{}
+	rest := strings.TrimSpace(line)
+	for rest != "" {
+		eq := strings.IndexByte(rest, '=')
+		sp := strings.IndexByte(rest, ' ')
+		if eq < 0 || (sp >= 0 && sp < eq) {
+			end := len(rest)
+			if sp >= 0 {
+				end = sp
+			}
+			return nil, fmt.Errorf("plain: token %q has no '='", rest[:end])
+		}
+		key := rest[:eq]
+		if key == "" {
+			return nil, fmt.Errorf("plain: empty key")
+		}
+		rest = rest[eq+1:]
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			// Quoted value: closes at a '"' followed by a space or end of line.
+			end := -1
+			for i := 1; i < len(rest); i++ {
+				if rest[i] == '"' && (i == len(rest)-1 || rest[i+1] == ' ') {
+					end = i
+					break
+				}
+			}
+			if end < 0 {
+				return nil, fmt.Errorf("plain: unterminated quote for key %q", key)
+			}
+			value, rest = rest[1:end], rest[end+1:]
+		} else if sp := strings.IndexByte(rest, ' '); sp >= 0 {
+			value, rest = rest[:sp], rest[sp:]
+		} else {
+			value, rest = rest, ""
+		}
+		rest = strings.TrimLeft(rest, " ")
+
+		if err := setDotted(result, key, value); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// DetectFormat guesses which output format produced s. Rules, in order:
+//
+//   - starts with '{' or '[' → json (ok only if s is valid JSON)
+//   - starts with "---" → yaml
+//   - every non-empty line parses with ParsePlain → plain
+//   - first line looks like "key:" or "- item" → yaml (ok=false, no "---" marker)
+//   - anything else, including empty input → plain (ok=false)
+//
+// Leading whitespace is ignored. ok=false marks a best-effort guess.
+func DetectFormat(s string) (OutputFormat, bool) {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "":
+		return OutputFormatPlain, false
+	case s[0] == '{' || s[0] == '[':
+		return OutputFormatJson, json.Valid([]byte(s))
+	case strings.HasPrefix(s, "---"):
+		return OutputFormatYaml, true
+	}
+	lines := strings.Split(s, "\n")
+	plain := true
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if _, err := ParsePlain(line); err != nil {
+			plain = false
+			break
+		}
+	}
+	if plain {
+		return OutputFormatPlain, true
+	}
+	first := lines[0]
+	if strings.HasPrefix(first, "- ") || strings.HasSuffix(first, ":") || strings.Contains(first, ": ") {
+		return OutputFormatYaml, false
+	}
+	return OutputFormatPlain, false
+}
+
+// Reformat detects the format of input (see DetectFormat), parses it back
+// and re-emits it via CliOutput in the target format. Parsing is scoped to
+// the library's own output: JSON is decoded with numbers preserved (several
+// values, as in JSON Lines, become an array), YAML via ParseYaml, and plain
+// via ParsePlain (several lines become an array).
+// Keys already stripped by YAML/plain output stay stripped.
+func Reformat(input string, to OutputFormat) (string, error) {
+	var value any
+	format, _ := DetectFormat(input)
+	switch format {
+	case OutputFormatJson:
+		dec := json.NewDecoder(strings.NewReader(input))
+		dec.UseNumber()
+		var values []any
+		for {
+			var v any
+			err := dec.Decode(&v)
+			if err == io.EOF && len(values) > 0 {
+				break
+			}
+			if err != nil {
+				return "", fmt.Errorf("json: %w", err)
+			}
+			values = append(values, v)
+		}
+		if len(values) == 1 {
+			value = values[0]
+		} else {
+			value = values
+		}
+	case OutputFormatYaml:
+		v, err := ParseYaml(input)
+		if err != nil {
+			return "", err
+		}
+		value = v
+	default:
+		var rows []any
+		for _, line := range strings.Split(strings.TrimSpace(input), "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			m, err := ParsePlain(line)
+			if err != nil {
+				return "", err
+			}
+			rows = append(rows, m)
+		}
+		switch len(rows) {
+		case 0:
+			value = map[string]any{}
+		case 1:
+			value = rows[0]
+		default:
+			value = rows
+		}
+	}
+	return CliOutput(value, to), nil
+}
+
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+// ParseYaml parses the YAML subset emitted by OutputYaml back into a
+// map[string]any, or a []any when the document is a top-level list.
+// It is not a general YAML parser. Supported:
+//
+//   - an optional leading "---" marker
+//   - two-space indentation (tabs and odd indents are rejected)
+//   - "key: value" and "key:" followed by an indented map or list
+//   - "- item" scalar list entries and "-" followed by an indented map or list
+//   - double-quoted strings with \\ \" \n \r \t escapes
+//   - null, true, false, JSON numbers (kept as json.Number), {} and []
+//
+// Other bare scalars (RawString output) are returned as strings. Anchors,
+// flow collections, block scalars, comments and top-level scalars are
+// rejected. As with ParsePlain, keys stay stripped and formatted values
+// stay strings.
+func ParseYaml(s string) (any, error) {
+	var lines []yamlLine
+	for i, raw := range strings.Split(strings.TrimRight(s, "\n"), "\n") {
+		raw = strings.TrimRight(raw, "\r")
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+		if len(lines) == 0 && raw == "---" {
+			continue
+		}
+		text := strings.TrimLeft(raw, " ")
+		spaces := len(raw) - len(text)
+		if spaces%2 != 0 || strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("yaml: line %d: indentation must be two spaces", i+1)
+		}
+		lines = append(lines, yamlLine{num: i + 1, indent: spaces / 2, text: text})
+	}
+	var (
+		v   any
+		pos int
+		err error
+	)
+	switch {
+	case len(lines) == 1 && lines[0].text == "[]":
+		v, pos = []any{}, 1
+	case len(lines) > 0 && strings.HasPrefix(lines[0].text, "-"):
+		v, pos, err = parseYamlList(lines, 0, 0)
+	default:
+		v, pos, err = parseYamlMap(lines, 0, 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if pos < len(lines) {
+		return nil, fmt.Errorf("yaml: line %d: unexpected indentation", lines[pos].num)
+	}
+	return v, nil
+}
+
+func parseYamlMap(lines []yamlLine, pos, indent int) (map[string]any, int, error) {
+	m := map[string]any{}
+	for pos < len(lines) && lines[pos].indent == indent {
+		line := lines[pos]
+		if strings.HasPrefix(line.text, "-") {
+			return nil, pos, fmt.Errorf("yaml: line %d: unexpected list item", line.num)
+		}
+		key, rest, err := splitYamlEntry(line)
+		if err != nil {
+			return nil, pos, err
+		}
+		if _, dup := m[key]; dup {
+			return nil, pos, fmt.Errorf("yaml: line %d: duplicate key %q", line.num, key)
+		}
+		pos++
+		if rest != "" {
+			v, err := parseYamlScalar(rest, line.num)
+			if err != nil {
+				return nil, pos, err
+			}
+			m[key] = v
+			continue
+		}
+		if pos >= len(lines) || lines[pos].indent != indent+1 {
+			return nil, pos, fmt.Errorf("yaml: line %d: key %q has no value", line.num, key)
+		}
+		var v any
+		if strings.HasPrefix(lines[pos].text, "-") {
+			v, pos, err = parseYamlList(lines, pos, indent+1)
+		} else {
+			v, pos, err = parseYamlMap(lines, pos, indent+1)
+		}
+		if err != nil {
+			return nil, pos, err
+		}
+		m[key] = v
+	}
+	return m, pos, nil
+}
+
+// splitYamlEntry splits "key: value" or "key:" into key and value text.
+// Keys may be double-quoted (see yamlKey).
+func splitYamlEntry(line yamlLine) (key, rest string, err error) {
+	text := line.text
+	if strings.HasPrefix(text, `"`) {
+		end := 1
+		for end < len(text) && text[end] != '"' {
+			if text[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(text) {
+			return "", "", fmt.Errorf("yaml: line %d: unterminated key", line.num)
+		}
+		k, err := parseYamlScalar(text[:end+1], line.num)
+		if err != nil {
+			return "", "", err
+		}
+		key, text = k.(string), text[end+1:]
+		switch {
+		case text == ":":
+			return key, "", nil
+		case strings.HasPrefix(text, ": "):
+			return key, text[2:], nil
+		}
+		return "", "", fmt.Errorf("yaml: line %d: expected \"key: value\"", line.num)
+	}
+	if i := strings.Index(text, ": "); i >= 0 {
+		key, rest = text[:i], text[i+2:]
+	} else if strings.HasSuffix(text, ":") {
+		key = strings.TrimSuffix(text, ":")
+	} else {
+		return "", "", fmt.Errorf("yaml: line %d: expected \"key: value\"", line.num)
+	}
+	if key == "" || strings.HasPrefix(key, "#") {
+		return "", "", fmt.Errorf("yaml: line %d: expected \"key: value\"", line.num)
+	}
+	return key, rest, nil
+}
+
+func parseYamlList(lines []yamlLine, pos, indent int) ([]any, int, error) {
+	items := []any{}
+	for pos < len(lines) && lines[pos].indent == indent && strings.HasPrefix(lines[pos].text, "-") {
+		line := lines[pos]
+		pos++
+		if line.text == "-" {
+			if pos >= len(lines) || lines[pos].indent != indent+1 {
+				return nil, pos, fmt.Errorf("yaml: line %d: empty list item", line.num)
+			}
+			var v any
+			var next int
+			var err error
+			if strings.HasPrefix(lines[pos].text, "-") {
+				v, next, err = parseYamlList(lines, pos, indent+1)
+			} else {
+				v, next, err = parseYamlMap(lines, pos, indent+1)
+			}
+			if err != nil {
+				return nil, next, err
+			}
+			items, pos = append(items, v), next
+			continue
+		}
+		if !strings.HasPrefix(line.text, "- ") {
+			return nil, pos, fmt.Errorf("yaml: line %d: expected \"- item\"", line.num)
+		}
+		v, err := parseYamlScalar(line.text[2:], line.num)
+		if err != nil {
+			return nil, pos, err
+		}
+		items = append(items, v)
+	}
+	return items, pos, nil
+}
+
+func parseYamlScalar(s string, num int) (any, error) {
+	switch s {
+	case "":
+		return nil, fmt.Errorf("yaml: line %d: empty value", num)
+	case "null":
+		return nil, nil
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "{}":
+		return map[string]any{}, nil
+	case "[]":
+		return []any{}, nil
+	}
+	if strings.ContainsRune("&*!|>{[#'", rune(s[0])) {
+		return nil, fmt.Errorf("yaml: line %d: unsupported syntax %q", num, s)
+	}
+	if strings.HasPrefix(s, `"`) {
+		if len(s) < 2 || !strings.HasSuffix(s, `"`) {
+			return nil, fmt.Errorf("yaml: line %d: unterminated string", num)
+		}
+		var b strings.Builder
+		body := s[1 : len(s)-1]
+		for i := 0; i < len(body); i++ {
+			c := body[i]
+			if c == '"' {
+				return nil, fmt.Errorf("yaml: line %d: unescaped quote in string", num)
+			}
+			if c != '\\' {
+				b.WriteByte(c)
+				continue
+			}
+			i++
+			if i >= len(body) {
+				return nil, fmt.Errorf("yaml: line %d: unterminated string", num)
+			}
+			switch body[i] {
+			case '\\', '"':
+				b.WriteByte(body[i])
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				return nil, fmt.Errorf("yaml: line %d: unsupported escape \\%c", num, body[i])
+			}
+		}
+		return b.String(), nil
+	}
+	if n := json.Number(s); json.Valid([]byte(s)) && (s[0] == '-' || s[0] >= '0' && s[0] <= '9') {
+		return n, nil
+	}
+	return s, nil
+}
+
+// humanDurationUnits maps the unit text of YAML/plain duration output
+// (_ns, _us, _ms, _s, _minutes, _hours, _days) to its length.
+var humanDurationUnits = []struct {
+	unit string
+	d    time.Duration
+}{
+	{" minutes", time.Minute},
+	{" hours", time.Hour},
+	{" days", 24 * time.Hour},
+	{"ns", time.Nanosecond},
+	{"\u03bcs", time.Microsecond}, // Greek mu, as emitted
+	{"\u00b5s", time.Microsecond}, // micro sign
+	{"us", time.Microsecond},
+	{"ms", time.Millisecond},
+	{"s", time.Second},
+}
+
+// ParseHumanDuration reverses the duration rendering of YAML/plain output:
+// "150ms", "1.5s", "250ns", "3μs" (or µs/us), "30 minutes", "2 hours",
+// "1.5 days". Fractions round to the nearest nanosecond. Returns false for
+// unknown units, malformed numbers, or values overflowing time.Duration.
+func ParseHumanDuration(s string) (time.Duration, bool) {
+	for _, u := range humanDurationUnits {
+		num, ok := strings.CutSuffix(s, u.unit)
+		if !ok {
+			continue
+		}
+		if !isPlainNumber(num) {
+			return 0, false
+		}
+		f, err := strconv.ParseFloat(num, 64)
+		if err != nil {
+			return 0, false
+		}
+		ns := math.Round(f * float64(u.d))
+		if ns < math.MinInt64 || ns >= math.MaxInt64 {
+			return 0, false
+		}
+		return time.Duration(ns), true
+	}
+	return 0, false
+}
+
+// isPlainNumber reports whether s is a decimal number as emitted by
+// plainScalar (optional sign, digits, fraction, exponent), rejecting forms
+// strconv also accepts such as "Inf", "NaN", hex and underscores.
+func isPlainNumber(s string) bool {
+	s = strings.TrimPrefix(s, "-")
+	if s == "" || s[0] < '0' || s[0] > '9' {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c == '.' || c == 'e' || c == 'E' || c == '+' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// setDotted stores value at a dot-notation path, creating nested maps.
+func setDotted(m map[string]any, key string, value any) error {
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		switch next := m[part].(type) {
+		case nil:
+			child := map[string]any{}
+			m[part] = child
+			m = child
+		case map[string]any:
+			m = next
+		default:
+			return fmt.Errorf("plain: key %q conflicts with scalar %q", key, part)
+		}
+	}
+	last := parts[len(parts)-1]
+	if _, exists := m[last]; exists {
+		return fmt.Errorf("plain: duplicate key %q", key)
+	}
+	m[last] = value
+	return nil
+}
@@ -0,0 +1,343 @@
+package afdata
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func assertJSONEqual(t *testing.T, got, want any) {
+	t.Helper()
+	g, _ := json.Marshal(got)
+	w, _ := json.Marshal(want)
+	if string(g) != string(w) {
+		t.Errorf("got %s, want %s", g, w)
+	}
+}
+
+// ═══════════════════════════════════════════
+// ParsePlain
+// ═══════════════════════════════════════════
+
+func TestParsePlainRoundTripFlat(t *testing.T) {
+	input := map[string]any{"name": "alice", "message": "hello world", "count": "42", "empty": ""}
+	got, err := ParsePlain(OutputPlain(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSONEqual(t, got, input)
+}
+
+func TestParsePlainRoundTripFormattedNested(t *testing.T) {
+	got, err := ParsePlain(OutputPlain(map[string]any{
+		"code":           "ok",
+		"api_key_secret": "sk-1",
+		"trace":          map[string]any{"duration_ms": 1500, "size_bytes": 5242880, "note": "two words"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Keys come back stripped and values as their formatted strings.
+	assertJSONEqual(t, got, map[string]any{
+		"api_key": "***",
+		"code":    "ok",
+		"trace":   map[string]any{"duration": "1.5s", "note": "two words", "size": "5.0MB"},
+	})
+}
+
+func TestParsePlainDottedKeys(t *testing.T) {
+	got, err := ParsePlain("code=ok trace.duration=1.5s trace.db.host=db1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSONEqual(t, got, map[string]any{
+		"code":  "ok",
+		"trace": map[string]any{"duration": "1.5s", "db": map[string]any{"host": "db1"}},
+	})
+}
+
+func TestParsePlainEmptyValue(t *testing.T) {
+	got, err := ParsePlain("value= next=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSONEqual(t, got, map[string]any{"value": "", "next": "1"})
+}
+
+func TestParsePlainQuotedWithSpaces(t *testing.T) {
+	got, err := ParsePlain(`message="a b  c" x=1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSONEqual(t, got, map[string]any{"message": "a b  c", "x": "1"})
+}
+
+func TestParsePlainErrors(t *testing.T) {
+	for _, line := range []string{"novalue", `a="unterminated`, "=x", "a=1 a.b=2", "a=1 a=2"} {
+		if _, err := ParsePlain(line); err == nil {
+			t.Errorf("ParsePlain(%q): expected error", line)
+		}
+	}
+}
+
+func TestParsePlainEmptyLine(t *testing.T) {
+	got, err := ParsePlain("")
+	if err != nil || len(got) != 0 {
+		t.Errorf("ParsePlain(\"\") = (%v, %v), want empty map", got, err)
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	data := map[string]any{"user": "alice", "latency_ms": 150, "trace": map[string]any{"id": "x"}}
+	tests := []struct {
+		name   string
+		input  string
+		want   OutputFormat
+		wantOk bool
+	}{
+		{"json object", OutputJson(data), OutputFormatJson, true},
+		{"json array", `[1, 2]`, OutputFormatJson, true},
+		{"invalid json", `{not json`, OutputFormatJson, false},
+		{"yaml", OutputYaml(data), OutputFormatYaml, true},
+		{"plain", OutputPlain(data), OutputFormatPlain, true},
+		{"plain multiline", "a=1 b=2\nc=3\n", OutputFormatPlain, true},
+		{"yaml without marker", "user: alice\nlatency: 150ms", OutputFormatYaml, false},
+		{"free text", "hello world", OutputFormatPlain, false},
+		{"empty", "  \n", OutputFormatPlain, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := DetectFormat(tt.input)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("DetectFormat(%q) = (%q, %v), want (%q, %v)", tt.input, got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestReformatJsonYamlJsonRoundTrip(t *testing.T) {
+	input := OutputJson(map[string]any{
+		"name":    "alice",
+		"count":   3,
+		"ratio":   0.25,
+		"enabled": true,
+		"missing": nil,
+		"note":    "say \"hi\"\nbye",
+		"tags":    []any{"a", 2},
+		"empty":   map[string]any{},
+		"none":    []any{},
+		"items":   []any{map[string]any{"id": 1}, map[string]any{"id": 2}},
+		"trace":   map[string]any{"source": "db", "deep": map[string]any{"x": "y"}},
+	})
+	yaml, err := Reformat(input, OutputFormatYaml)
+	if err != nil {
+		t.Fatalf("json→yaml: %v", err)
+	}
+	back, err := Reformat(yaml, OutputFormatJson)
+	if err != nil {
+		t.Fatalf("yaml→json: %v\n%s", err, yaml)
+	}
+	assertEqual(t, back, input)
+}
+
+func TestReformatStripsSuffixesOnce(t *testing.T) {
+	yaml, err := Reformat(`{"latency_ms":1500,"api_key_secret":"sk-1"}`, OutputFormatYaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Reformat(yaml, OutputFormatPlain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, got, "api_key=*** latency=1.5s")
+}
+
+func TestReformatPlainToJson(t *testing.T) {
+	got, err := Reformat("code=ok trace.source=db\ncode=error\n", OutputFormatJson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, got, `[{"code":"ok","trace":{"source":"db"}},{"code":"error"}]`)
+}
+
+func TestReformatJsonLines(t *testing.T) {
+	got, err := Reformat("{\"code\":\"ok\"}\n{\"code\":\"error\"}\n", OutputFormatJson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, got, `[{"code":"ok"},{"code":"error"}]`)
+}
+
+func TestReformatErrors(t *testing.T) {
+	for _, input := range []string{
+		`{not json`,
+		"{\"a\":1}\n{bad",
+		"---\n- ",
+		"---\nkey: \"open",
+		"---\nkey:\n   odd: 1",
+		"---\nkey:",
+		"hello world",
+	} {
+		if _, err := Reformat(input, OutputFormatJson); err == nil {
+			t.Errorf("Reformat(%q) returned no error", input)
+		}
+	}
+}
+
+// ═══════════════════════════════════════════
+// ParseYaml
+// ═══════════════════════════════════════════
+
+func TestParseYamlRoundTrip(t *testing.T) {
+	input := map[string]any{
+		"name":    "alice",
+		"note":    "say \"hi\"\n\tbye \\ ok",
+		"enabled": false,
+		"missing": nil,
+		"empty":   map[string]any{},
+		"none":    []any{},
+		"tags":    []any{"a", "b"},
+		"items":   []any{map[string]any{"id": "1"}, map[string]any{"id": "2", "sub": map[string]any{"k": "v"}}},
+		"trace":   map[string]any{"source": "db"},
+	}
+	got, err := ParseYaml(OutputYaml(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSONEqual(t, got, input)
+}
+
+func TestParseYamlTopLevelListRoundTrip(t *testing.T) {
+	input := []any{
+		"a",
+		[]any{1, 2},
+		[]any{[]any{"x"}, []any{}},
+		map[string]any{"id": "1", "tags": []any{[]any{"p", "q"}}},
+		map[string]any{},
+		nil,
+	}
+	out := OutputYaml(input)
+	assertNotContains(t, out, "[1 2]")
+	got, err := ParseYaml(out)
+	if err != nil {
+		t.Fatalf("ParseYaml(%q): %v", out, err)
+	}
+	assertJSONEqual(t, got, input)
+
+	empty, err := ParseYaml(OutputYaml([]any{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSONEqual(t, empty, []any{})
+}
+
+func TestReformatTopLevelYamlList(t *testing.T) {
+	out, err := Reformat(OutputYaml([]any{map[string]any{"id": 1}, []any{1, 2}}), OutputFormatJson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, out, `[{"id":1},[1,2]]`)
+}
+
+func TestParseYamlFormattedValuesStayStrings(t *testing.T) {
+	got, err := ParseYaml(OutputYaml(map[string]any{"latency_ms": 1500, "count": 42, "ratio_x": 0.5}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSONEqual(t, got, map[string]any{"count": 42, "latency": "1.5s", "ratio_x": 0.5})
+}
+
+func TestParseYamlRejectsOutsideSubset(t *testing.T) {
+	for _, input := range []string{
+		"---\nkey: &anchor x",
+		"---\nkey: {a: 1}",
+		"---\nkey: |",
+		"---\n# comment",
+		"---\nkey:\n\tchild: 1",
+		"---\nkey:\n   child: 1",
+		"---\nkey: \"bad \\x escape\"",
+		"---\nkey: 1\nkey: 2",
+		"---\n\"scalar\"",
+	} {
+		if _, err := ParseYaml(input); err == nil {
+			t.Errorf("ParseYaml(%q): expected error", input)
+		}
+	}
+}
+
+func TestParseYamlEmptyScalarIsLineError(t *testing.T) {
+	for input, line := range map[string]string{
+		"- ":       "line 1",
+		"a:\n  - ": "line 2",
+	} {
+		_, err := ParseYaml(input)
+		if err == nil || !strings.Contains(err.Error(), line) {
+			t.Errorf("ParseYaml(%q) error = %v, want %s", input, err, line)
+		}
+	}
+}
+
+func TestParseYamlEmptyDocument(t *testing.T) {
+	got, err := ParseYaml(OutputYaml(map[string]any{}))
+	if m, ok := got.(map[string]any); err != nil || !ok || len(m) != 0 {
+		t.Errorf("ParseYaml(empty) = (%v, %v), want empty map", got, err)
+	}
+}
+
+// ═══════════════════════════════════════════
+// ParseHumanDuration
+// ═══════════════════════════════════════════
+
+func TestParseHumanDurationRoundTrip(t *testing.T) {
+	tests := []struct {
+		key   string
+		value any
+		want  time.Duration
+	}{
+		{"latency_ms", 150, 150 * time.Millisecond},
+		{"latency_ms", 1500, 1500 * time.Millisecond},
+		{"latency_ms", -2500, -2500 * time.Millisecond},
+		{"timeout_s", 30, 30 * time.Second},
+		{"elapsed_ns", 250, 250 * time.Nanosecond},
+		{"elapsed_us", 3.5, 3500 * time.Nanosecond},
+		{"window_minutes", 30, 30 * time.Minute},
+		{"ttl_hours", 2, 2 * time.Hour},
+		{"retention_days", 1.5, 36 * time.Hour},
+	}
+	for _, tt := range tests {
+		_, formatted, ok := tryProcessField(tt.key, tt.value)
+		if !ok {
+			t.Fatalf("tryProcessField(%q, %v) did not format", tt.key, tt.value)
+		}
+		got, ok := ParseHumanDuration(formatted)
+		if !ok || got != tt.want {
+			t.Errorf("ParseHumanDuration(%q) = (%v, %v), want %v", formatted, got, ok, tt.want)
+		}
+	}
+}
+
+func TestParseHumanDurationMicroSign(t *testing.T) {
+	for _, s := range []string{"3µs", "3μs", "3us"} {
+		if got, ok := ParseHumanDuration(s); !ok || got != 3*time.Microsecond {
+			t.Errorf("ParseHumanDuration(%q) = (%v, %v), want 3µs", s, got, ok)
+		}
+	}
+}
+
+func TestParseHumanDurationRejects(t *testing.T) {
+	for _, s := range []string{"", "s", "1.5", "1.5 s", "30minutes", "2 weeks", "Infs", "NaNms", "0x10s", "1_000ms", " 1s", "1e300 days"} {
+		if got, ok := ParseHumanDuration(s); ok {
+			t.Errorf("ParseHumanDuration(%q) = %v, want false", s, got)
+		}
+	}
+}
+
+func TestParseYamlQuotedKeysRoundTrip(t *testing.T) {
+	input := map[string]any{"on": "yes", "123": "n", "a: b": map[string]any{"~": "x", "say \"hi\"": "y"}}
+	got, err := ParseYaml(OutputYaml(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSONEqual(t, got, input)
+}
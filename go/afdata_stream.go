@@ -0,0 +1,78 @@
+package afdata
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// ═══════════════════════════════════════════
+// Public API: Streaming Writers
+// ═══════════════════════════════════════════
+
+// ErrWriterClosed is returned when writing to a closed stream writer.
+var ErrWriterClosed = errors.New("afdata: writer closed")
+
+// JsonArrayWriter emits a single JSON array incrementally: "[" before the
+// first element, comma-separated elements as they arrive, "]" on Close.
+// Elements are redacted like OutputJson and never buffered.
+type JsonArrayWriter struct {
+	w      io.Writer
+	mu     sync.Mutex
+	count  int
+	closed bool
+	err    error
+}
+
+// NewJsonArrayWriter creates a JsonArrayWriter writing to w.
+func NewJsonArrayWriter(w io.Writer) *JsonArrayWriter {
+	return &JsonArrayWriter{w: w}
+}
+
+// Write appends one redacted element to the array.
+// After a write error, all subsequent calls return the same error.
+func (a *JsonArrayWriter) Write(value any) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err != nil {
+		return a.err
+	}
+	if a.closed {
+		return ErrWriterClosed
+	}
+	sep := ","
+	if a.count == 0 {
+		sep = "["
+	}
+	v := sanitizeForJSON(value)
+	redactAll(v)
+	if _, err := io.WriteString(a.w, sep+marshalOutputJSON(v)); err != nil {
+		a.err = err
+		return err
+	}
+	a.count++
+	return nil
+}
+
+// Close terminates the array. An empty stream produces "[]".
+// Closing twice returns ErrWriterClosed.
+func (a *JsonArrayWriter) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err != nil {
+		return a.err
+	}
+	if a.closed {
+		return ErrWriterClosed
+	}
+	a.closed = true
+	tail := "]"
+	if a.count == 0 {
+		tail = "[]"
+	}
+	if _, err := io.WriteString(a.w, tail); err != nil {
+		a.err = err
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package afdata
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestJsonArrayWriterEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewJsonArrayWriter(&buf)
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	assertEqual(t, buf.String(), "[]")
+}
+
+func TestJsonArrayWriterOne(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewJsonArrayWriter(&buf)
+	if err := w.Write(map[string]any{"api_key_secret": "sk-123"}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	assertEqual(t, buf.String(), `[{"api_key_secret":"***"}]`)
+}
+
+func TestJsonArrayWriterMultiple(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewJsonArrayWriter(&buf)
+	for i := 0; i < 3; i++ {
+		if err := w.Write(map[string]any{"i": i}); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	var got []map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON array: %v (%s)", err, buf.String())
+	}
+	if len(got) != 3 {
+		t.Errorf("len = %d, want 3", len(got))
+	}
+}
+
+func TestJsonArrayWriterUnsupportedValueStaysValid(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewJsonArrayWriter(&buf)
+	if err := w.Write(map[string]any{"fn": func() {}}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	w.Close()
+	var got []any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON array: %v (%s)", err, buf.String())
+	}
+}
+
+func TestJsonArrayWriterWriteAfterClose(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewJsonArrayWriter(&buf)
+	w.Close()
+	if err := w.Write(1); !errors.Is(err, ErrWriterClosed) {
+		t.Errorf("Write after Close = %v, want ErrWriterClosed", err)
+	}
+	if err := w.Close(); !errors.Is(err, ErrWriterClosed) {
+		t.Errorf("second Close = %v, want ErrWriterClosed", err)
+	}
+}
+
+type failingWriter struct{ err error }
+
+func (f failingWriter) Write([]byte) (int, error) { return 0, f.err }
+
+func TestJsonArrayWriterPropagatesWriteError(t *testing.T) {
+	boom := errors.New("boom")
+	w := NewJsonArrayWriter(failingWriter{boom})
+	if err := w.Write(1); !errors.Is(err, boom) {
+		t.Errorf("Write = %v, want boom", err)
+	}
+	if err := w.Close(); !errors.Is(err, boom) {
+		t.Errorf("Close after failure = %v, want boom", err)
+	}
+}
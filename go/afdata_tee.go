@@ -0,0 +1,71 @@
+package afdata
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync/atomic"
+)
+
+// ═══════════════════════════════════════════
+// Public API: Sampled Tee Handler
+// ═══════════════════════════════════════════
+
+// SampledTeeHandler writes every record to a full-fidelity sink and a
+// sampled view to a second sink: info and above always, but only every Nth
+// trace/debug record. Typical use is sampled debug lines on stdout with a
+// debug file capturing everything. All levels are enabled.
+type SampledTeeHandler struct {
+	sampled *AfdataHandler
+	full    *AfdataHandler
+	everyN  uint64
+	seen    *atomic.Uint64 // trace/debug records so far, shared via WithAttrs
+}
+
+// NewSampledTeeHandler creates a SampledTeeHandler writing both sinks in
+// format. The 1st, (N+1)th, (2N+1)th... trace/debug record reaches
+// sampledSink; everyN <= 1 disables sampling.
+func NewSampledTeeHandler(sampledSink, fullSink io.Writer, format LogFormat, everyN int) *SampledTeeHandler {
+	if everyN < 1 {
+		everyN = 1
+	}
+	return &SampledTeeHandler{
+		sampled: NewAfdataHandler(sampledSink, format),
+		full:    NewAfdataHandler(fullSink, format),
+		everyN:  uint64(everyN),
+		seen:    &atomic.Uint64{},
+	}
+}
+
+// Enabled always returns true: the full sink receives every level.
+func (h *SampledTeeHandler) Enabled(_ context.Context, _ slog.Level) bool {
+	return true
+}
+
+// Handle writes r to the full sink and, unless sampled out, the sampled sink.
+func (h *SampledTeeHandler) Handle(ctx context.Context, r slog.Record) error {
+	err := h.full.Handle(ctx, r)
+	if r.Level >= slog.LevelInfo || (h.seen.Add(1)-1)%h.everyN == 0 {
+		err = errors.Join(err, h.sampled.Handle(ctx, r))
+	}
+	return err
+}
+
+// WithAttrs returns a handler with additional span-level fields on both
+// sinks, sharing the sampling counter.
+func (h *SampledTeeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.sampled = h.sampled.WithAttrs(attrs).(*AfdataHandler)
+	c.full = h.full.WithAttrs(attrs).(*AfdataHandler)
+	return &c
+}
+
+// WithGroup returns a handler that nests later fields under name on both
+// sinks, sharing the sampling counter.
+func (h *SampledTeeHandler) WithGroup(name string) slog.Handler {
+	c := *h
+	c.sampled = h.sampled.WithGroup(name).(*AfdataHandler)
+	c.full = h.full.WithGroup(name).(*AfdataHandler)
+	return &c
+}
@@ -0,0 +1,57 @@
+package afdata
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSampledTeeHandlerSamplesDebugOnly(t *testing.T) {
+	var sampled, full bytes.Buffer
+	logger := slog.New(NewSampledTeeHandler(&sampled, &full, FormatPlain, 3))
+	for i := 0; i < 7; i++ {
+		logger.Debug("tick", "seq", i)
+	}
+	logger.Info("done")
+	logger.Error("failed")
+
+	if got := strings.Count(full.String(), "\n"); got != 9 {
+		t.Errorf("full sink: expected 9 lines, got %d:\n%s", got, full.String())
+	}
+	lines := strings.Split(strings.TrimSuffix(sampled.String(), "\n"), "\n")
+	want := []string{"seq=0", "seq=3", "seq=6", "message=done", "message=failed"}
+	if len(lines) != len(want) {
+		t.Fatalf("sampled sink: expected %d lines, got %d:\n%s", len(want), len(lines), sampled.String())
+	}
+	for i, w := range want {
+		if !strings.Contains(lines[i], w) {
+			t.Errorf("sampled line %d = %q, want it to contain %q", i, lines[i], w)
+		}
+	}
+}
+
+func TestSampledTeeHandlerWithAttrsSharesCounter(t *testing.T) {
+	var sampled, full bytes.Buffer
+	h := NewSampledTeeHandler(&sampled, &full, FormatJson, 2)
+	slog.New(h).Debug("a")
+	slog.New(h).With("span", "s").Debug("b")
+	slog.New(h).With("span", "s").Debug("c")
+
+	if got := strings.Count(sampled.String(), "\n"); got != 2 {
+		t.Errorf("expected 2 sampled lines, got %d:\n%s", got, sampled.String())
+	}
+	if !strings.Contains(full.String(), `"span":"s"`) || strings.Count(full.String(), "\n") != 3 {
+		t.Errorf("full sink should have all 3 lines with span fields:\n%s", full.String())
+	}
+}
+
+func TestSampledTeeHandlerEveryOneKeepsAll(t *testing.T) {
+	var sampled, full bytes.Buffer
+	logger := slog.New(NewSampledTeeHandler(&sampled, &full, FormatJson, 0))
+	logger.Debug("a")
+	logger.Debug("b")
+	if sampled.String() != full.String() {
+		t.Errorf("sinks differ without sampling:\n%s\nvs\n%s", sampled.String(), full.String())
+	}
+}
@@ -0,0 +1,210 @@
+package afdata
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ═══════════════════════════════════════════
+// Public API: TOML Output
+// ═══════════════════════════════════════════
+
+// OutputToml formats a map as a TOML document. Keys stripped, values
+// formatted, secrets redacted (same processing as OutputYaml). Nested maps
+// become [section] tables, arrays of maps become [[section]] array tables,
+// other arrays become inline arrays. Keys are emitted in JCS order.
+// TOML has no null, so null values are omitted. Non-map input falls back to
+// a single OutputJson line.
+func OutputToml(value any) string {
+	m, ok := prepareProcessed(value).(map[string]any)
+	if !ok {
+		return applyOutputHooks(OutputFormatToml, renderJSON(value))
+	}
+	var lines []string
+	renderTomlTable(m, nil, &lines)
+	return applyOutputHooks(OutputFormatToml, strings.Join(lines, "\n"))
+}
+
+func renderTomlTable(m map[string]any, path []string, lines *[]string) {
+	// Key/value pairs must precede sub-tables within a table.
+	var subs []processedField
+	for _, pf := range processObjectFields(m) {
+		if pf.isFormatted {
+			*lines = append(*lines, tomlKey(pf.key)+" = "+tomlString(pf.formatted))
+			continue
+		}
+		switch v := pf.value.(type) {
+		case map[string]any:
+			subs = append(subs, pf)
+		case []any:
+			if isTomlTableArray(v) {
+				subs = append(subs, pf)
+			} else {
+				*lines = append(*lines, tomlKey(pf.key)+" = "+tomlInlineArray(v))
+			}
+		case nil:
+			// TOML has no null.
+		default:
+			*lines = append(*lines, tomlKey(pf.key)+" = "+tomlScalar(v))
+		}
+	}
+	for _, pf := range subs {
+		sub := append(path[:len(path):len(path)], pf.key)
+		header := tomlPath(sub)
+		switch v := pf.value.(type) {
+		case map[string]any:
+			appendTomlHeader(lines, "["+header+"]")
+			renderTomlTable(v, sub, lines)
+		case []any:
+			for _, item := range v {
+				appendTomlHeader(lines, "[["+header+"]]")
+				renderTomlTable(item.(map[string]any), sub, lines)
+			}
+		}
+	}
+}
+
+func appendTomlHeader(lines *[]string, header string) {
+	if len(*lines) > 0 {
+		*lines = append(*lines, "")
+	}
+	*lines = append(*lines, header)
+}
+
+func isTomlTableArray(items []any) bool {
+	if len(items) == 0 {
+		return false
+	}
+	for _, item := range items {
+		if _, ok := item.(map[string]any); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func tomlInlineArray(items []any) string {
+	parts := make([]string, 0, len(items))
+	for _, item := range items {
+		switch v := item.(type) {
+		case nil:
+			continue
+		case []any:
+			parts = append(parts, tomlInlineArray(v))
+		case map[string]any:
+			parts = append(parts, tomlInlineTable(v))
+		default:
+			parts = append(parts, tomlScalar(v))
+		}
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+func tomlInlineTable(m map[string]any) string {
+	parts := make([]string, 0, len(m))
+	for _, pf := range processObjectFields(m) {
+		var value string
+		if pf.isFormatted {
+			value = tomlString(pf.formatted)
+		} else {
+			switch v := pf.value.(type) {
+			case nil:
+				continue
+			case []any:
+				value = tomlInlineArray(v)
+			case map[string]any:
+				value = tomlInlineTable(v)
+			default:
+				value = tomlScalar(v)
+			}
+		}
+		parts = append(parts, tomlKey(pf.key)+" = "+value)
+	}
+	if len(parts) == 0 {
+		return "{}"
+	}
+	return "{ " + strings.Join(parts, ", ") + " }"
+}
+
+func tomlScalar(value any) string {
+	switch v := value.(type) {
+	case string:
+		return tomlString(v)
+	case RawString:
+		return tomlString(string(v))
+	case []byte:
+		return tomlString(formatByteSlice(v))
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "nan"
+		case math.IsInf(v, 1):
+			return "inf"
+		case math.IsInf(v, -1):
+			return "-inf"
+		}
+		return formatFloatJSON(v)
+	case bool, int, int64, uint64:
+		return plainScalar(v)
+	default:
+		if n, ok := asInt64(v); ok {
+			return strconv.FormatInt(n, 10)
+		}
+		return tomlString(plainScalar(v))
+	}
+}
+
+// tomlString renders a TOML basic string.
+func tomlString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// tomlKey renders a bare key when possible, otherwise a quoted key.
+func tomlKey(key string) string {
+	if key == "" {
+		return `""`
+	}
+	for _, c := range key {
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return tomlString(key)
+		}
+	}
+	return key
+}
+
+func tomlPath(path []string) string {
+	parts := make([]string, len(path))
+	for i, p := range path {
+		parts[i] = tomlKey(p)
+	}
+	return strings.Join(parts, ".")
+}
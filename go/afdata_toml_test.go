@@ -0,0 +1,54 @@
+package afdata
+
+import "testing"
+
+func TestOutputTomlScalarsAndSections(t *testing.T) {
+	got := OutputToml(map[string]any{
+		"code":           "ok",
+		"api_key_secret": "sk-123",
+		"count":          42,
+		"enabled":        true,
+		"tags":           []any{"a", "b"},
+		"trace": map[string]any{
+			"duration_ms": 1500,
+			"db":          map[string]any{"host": "db1"},
+		},
+	})
+	want := `api_key = "***"
+code = "ok"
+count = 42
+enabled = true
+tags = ["a", "b"]
+
+[trace]
+duration = "1.5s"
+
+[trace.db]
+host = "db1"`
+	assertEqual(t, got, want)
+}
+
+func TestOutputTomlQuoting(t *testing.T) {
+	got := OutputToml(map[string]any{"message": "say \"hi\"\n\tnow", "user name": "x"})
+	assertEqual(t, got, `message = "say \"hi\"\n\tnow"`+"\n"+`"user name" = "x"`)
+}
+
+func TestOutputTomlArrayTablesAndNull(t *testing.T) {
+	got := OutputToml(map[string]any{
+		"items":   []any{map[string]any{"id": 1}, map[string]any{"id": 2}},
+		"missing": nil,
+		"mixed":   []any{1, "x", map[string]any{"size_bytes": 1024}},
+	})
+	want := `mixed = [1, "x", { size = "1.0KB" }]
+
+[[items]]
+id = 1
+
+[[items]]
+id = 2`
+	assertEqual(t, got, want)
+}
+
+func TestOutputTomlNonMapFallsBackToJson(t *testing.T) {
+	assertEqual(t, OutputToml([]any{1, 2}), "[1,2]")
+}
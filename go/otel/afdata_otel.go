@@ -0,0 +1,134 @@
+// Package afdataotel bridges AFDATA trace maps into OpenTelemetry attributes.
+//
+// It lives in its own module so the core afdata package stays dependency-free.
+package afdataotel
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+
+	afdata "github.com/cmnspore/agent-first-data/go"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// TraceToOtelAttrs converts an AFDATA trace map into OpenTelemetry attributes.
+//
+// Secrets are redacted first (same rules as OutputJson, including
+// RedactionOptions value rules). Nested maps flatten to
+// dot-separated keys ("db.duration_ms"). Values keep their type: integers →
+// INT64, floats → FLOAT64, strings → STRING, bools → BOOL, and homogeneous
+// arrays → the matching slice type. Anything else (mixed arrays, nulls inside
+// arrays) is encoded as a JSON string. Null values are omitted.
+// Attributes are returned sorted by key for deterministic output.
+func TraceToOtelAttrs(trace map[string]any) []attribute.KeyValue {
+	copied, _ := afdata.InternalRedactedCopy(trace).(map[string]any)
+
+	var attrs []attribute.KeyValue
+	flatten(copied, "", &attrs)
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].Key < attrs[j].Key })
+	return attrs
+}
+
+func flatten(m map[string]any, prefix string, attrs *[]attribute.KeyValue) {
+	for k, v := range m {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		if nested, ok := v.(map[string]any); ok {
+			flatten(nested, key, attrs)
+			continue
+		}
+		if kv, ok := toAttr(key, v); ok {
+			*attrs = append(*attrs, kv)
+		}
+	}
+}
+
+func toAttr(key string, value any) (attribute.KeyValue, bool) {
+	switch v := value.(type) {
+	case nil:
+		return attribute.KeyValue{}, false
+	case string:
+		return attribute.String(key, v), true
+	case bool:
+		return attribute.Bool(key, v), true
+	case []any:
+		return sliceAttr(key, v), true
+	}
+	if n, ok := asInt64(value); ok {
+		return attribute.Int64(key, n), true
+	}
+	if f, ok := asFloat64(value); ok {
+		return attribute.Float64(key, f), true
+	}
+	return attribute.String(key, jsonString(value)), true
+}
+
+func sliceAttr(key string, items []any) attribute.KeyValue {
+	strs, ints, floats, bools := []string{}, []int64{}, []float64{}, []bool{}
+	for _, item := range items {
+		switch v := item.(type) {
+		case string:
+			strs = append(strs, v)
+		case bool:
+			bools = append(bools, v)
+		default:
+			if n, ok := asInt64(v); ok {
+				ints = append(ints, n)
+				floats = append(floats, float64(n))
+			} else if f, ok := asFloat64(v); ok {
+				floats = append(floats, f)
+			}
+		}
+	}
+	switch len(items) {
+	case len(strs):
+		return attribute.StringSlice(key, strs)
+	case len(bools):
+		return attribute.BoolSlice(key, bools)
+	case len(ints):
+		return attribute.Int64Slice(key, ints)
+	case len(floats):
+		return attribute.Float64Slice(key, floats)
+	}
+	return attribute.String(key, jsonString(items))
+}
+
+// asInt64 and asFloat64 read the numeric leaves InternalRedactedCopy
+// produces: int64, uint64, float64 and json.Number.
+func asInt64(value any) (int64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return v, true
+	case uint64:
+		return int64(v), v <= math.MaxInt64
+	case json.Number:
+		n, err := v.Int64()
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func asFloat64(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case uint64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func jsonString(value any) string {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("<unsupported:%T>", value)
+	}
+	return string(b)
+}
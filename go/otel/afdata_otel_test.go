@@ -0,0 +1,130 @@
+package afdataotel
+
+import (
+	"math"
+	"regexp"
+	"testing"
+
+	afdata "github.com/cmnspore/agent-first-data/go"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func attrMap(attrs []attribute.KeyValue) map[string]attribute.Value {
+	m := make(map[string]attribute.Value, len(attrs))
+	for _, kv := range attrs {
+		m[string(kv.Key)] = kv.Value
+	}
+	return m
+}
+
+func TestTraceToOtelAttrsTyped(t *testing.T) {
+	got := attrMap(TraceToOtelAttrs(map[string]any{
+		"duration_ms": 150,
+		"ratio":       0.5,
+		"source":      "db",
+		"cached":      true,
+		"tags":        []any{"a", "b"},
+		"ids":         []any{1, 2},
+		"mixed":       []any{"a", 1},
+		"missing":     nil,
+	}))
+
+	checks := []struct {
+		key  string
+		kind attribute.Type
+	}{
+		{"duration_ms", attribute.INT64},
+		{"ratio", attribute.FLOAT64},
+		{"source", attribute.STRING},
+		{"cached", attribute.BOOL},
+		{"tags", attribute.STRINGSLICE},
+		{"ids", attribute.INT64SLICE},
+		{"mixed", attribute.STRING},
+	}
+	for _, c := range checks {
+		v, ok := got[c.key]
+		if !ok {
+			t.Errorf("%s missing", c.key)
+			continue
+		}
+		if v.Type() != c.kind {
+			t.Errorf("%s type = %v, want %v", c.key, v.Type(), c.kind)
+		}
+	}
+	if got["duration_ms"].AsInt64() != 150 {
+		t.Errorf("duration_ms = %v", got["duration_ms"].AsInt64())
+	}
+	if got["mixed"].AsString() != `["a",1]` {
+		t.Errorf("mixed = %q", got["mixed"].AsString())
+	}
+	if _, ok := got["missing"]; ok {
+		t.Error("null values should be omitted")
+	}
+}
+
+func TestTraceToOtelAttrsNestedAndRedacted(t *testing.T) {
+	trace := map[string]any{
+		"db":             map[string]any{"query_ms": 5, "conn": map[string]any{"host": "db1"}},
+		"api_key_secret": "sk-123",
+	}
+	attrs := TraceToOtelAttrs(trace)
+	got := attrMap(attrs)
+
+	if got["db.query_ms"].AsInt64() != 5 {
+		t.Errorf("db.query_ms = %v", got["db.query_ms"].Emit())
+	}
+	if got["db.conn.host"].AsString() != "db1" {
+		t.Errorf("db.conn.host = %v", got["db.conn.host"].Emit())
+	}
+	if got["api_key_secret"].AsString() != "***" {
+		t.Errorf("api_key_secret = %v, want ***", got["api_key_secret"].Emit())
+	}
+	if trace["api_key_secret"] != "sk-123" {
+		t.Error("caller trace must not be mutated")
+	}
+	for i := 1; i < len(attrs); i++ {
+		if attrs[i-1].Key >= attrs[i].Key {
+			t.Errorf("attrs not sorted: %s >= %s", attrs[i-1].Key, attrs[i].Key)
+		}
+	}
+}
+
+func TestTraceToOtelAttrsIntegerKinds(t *testing.T) {
+	got := attrMap(TraceToOtelAttrs(map[string]any{
+		"small":  int8(-3),
+		"port":   uint16(8080),
+		"bytes":  uint64(1 << 40),
+		"huge":   uint64(math.MaxUint64),
+		"ratio":  float32(0.5),
+		"counts": []any{uint8(1), int16(2)},
+	}))
+	for key, want := range map[string]int64{"small": -3, "port": 8080, "bytes": 1 << 40} {
+		if v := got[key]; v.Type() != attribute.INT64 || v.AsInt64() != want {
+			t.Errorf("%s = %v (%v), want INT64 %d", key, v.Emit(), v.Type(), want)
+		}
+	}
+	if v := got["huge"]; v.Type() != attribute.FLOAT64 {
+		t.Errorf("huge type = %v, want FLOAT64", v.Type())
+	}
+	if v := got["ratio"]; v.Type() != attribute.FLOAT64 || v.AsFloat64() != 0.5 {
+		t.Errorf("ratio = %v (%v), want FLOAT64 0.5", v.Emit(), v.Type())
+	}
+	if v := got["counts"]; v.Type() != attribute.INT64SLICE {
+		t.Errorf("counts type = %v, want INT64SLICE", v.Type())
+	}
+}
+
+func TestTraceToOtelAttrsValueRedaction(t *testing.T) {
+	opts := afdata.DefaultRedactionOptions()
+	opts.ValuePatterns = []*regexp.Regexp{regexp.MustCompile(`^sk-live-`)}
+	afdata.SetRedactionOptions(opts)
+	t.Cleanup(func() { afdata.SetRedactionOptions(afdata.DefaultRedactionOptions()) })
+
+	got := attrMap(TraceToOtelAttrs(map[string]any{
+		"header": "sk-live-abc123",
+		"nested": map[string]any{"note": "sk-live-def456"},
+	}))
+	if got["header"].AsString() != "***" || got["nested.note"].AsString() != "***" {
+		t.Errorf("value rules not applied: header=%v nested.note=%v", got["header"].Emit(), got["nested.note"].Emit())
+	}
+}
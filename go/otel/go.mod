@@ -0,0 +1,10 @@
+module github.com/cmnspore/agent-first-data/go/otel
+
+go 1.21
+
+require (
+	github.com/cmnspore/agent-first-data/go v0.7.0
+	go.opentelemetry.io/otel v1.28.0
+)
+
+replace github.com/cmnspore/agent-first-data/go => ../
@@ -3,6 +3,12 @@
 from agent_first_data.format import (
     build_json_ok,
     build_json_error,
+    build_json_error_code,
+    build_json_errors,
+    build_json_warning,
+    build_json_cursor,
+    build_json_startup,
+    build_json_batch,
     build_json,
     RedactionPolicy,
     output_json,
@@ -34,6 +40,12 @@ from agent_first_data.cli import (
 __all__ = [
     "build_json_ok",
     "build_json_error",
+    "build_json_error_code",
+    "build_json_errors",
+    "build_json_warning",
+    "build_json_cursor",
+    "build_json_startup",
+    "build_json_batch",
     "build_json",
     "RedactionPolicy",
     "output_json",
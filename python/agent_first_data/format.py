@@ -5,8 +5,11 @@
 
 from __future__ import annotations
 
+import base64
+import binascii
 import json
 import math
+import re
 from datetime import datetime, timezone
 from enum import Enum
 from typing import Any
@@ -35,6 +38,83 @@ def build_json_error(message: str, hint: str | None = None, trace: Any = None) -
     return m
 
 
+def build_json_error_code(message: str, error_code: str, retryable: bool, trace: Any = None) -> dict:
+    """Build {code: "error", error: message, error_code, retryable, trace?}."""
+    m: dict = {"code": "error", "error": message, "error_code": error_code, "retryable": retryable}
+    if trace is not None:
+        m["trace"] = trace
+    return m
+
+
+def build_json_errors(errors: list[str], trace: Any = None) -> dict:
+    """Build {code: "error", error: "<first> (+N more)", errors, retryable: False, trace?}."""
+    summary = errors[0] if errors else ""
+    if len(errors) > 1:
+        summary += f" (+{len(errors) - 1} more)"
+    m: dict = {"code": "error", "error": summary, "errors": list(errors), "retryable": False}
+    if trace is not None:
+        m["trace"] = trace
+    return m
+
+
+def build_json_warning(message: str, warning_code: str, trace: Any = None) -> dict:
+    """Build {code: "warning", warning: message, warning_code, retryable: False, trace?}."""
+    m: dict = {"code": "warning", "warning": message, "warning_code": warning_code, "retryable": False}
+    if trace is not None:
+        m["trace"] = trace
+    return m
+
+
+def build_json_batch(results: list[dict], trace: Any = None) -> dict:
+    """Build {code: "batch", results, count, failed_count, trace?}.
+
+    failed_count counts results whose code is "error".
+    """
+    m: dict = {
+        "code": "batch",
+        "results": list(results),
+        "count": len(results),
+        "failed_count": sum(1 for r in results if r.get("code") == "error"),
+    }
+    if trace is not None:
+        m["trace"] = trace
+    return m
+
+
+_ENV_SECRET_SUFFIXES = ("_KEY", "_TOKEN", "_SECRET")
+_ENV_SECRET_SUBSTRINGS = ("PASSWORD",)
+
+
+def build_json_startup(config: Any = None, args: Any = None, env: dict | None = None) -> dict:
+    """Build the startup event {code: "log", event: "startup", config?, args?, env?}.
+
+    Env values whose names end in _KEY, _TOKEN or _SECRET, or contain PASSWORD
+    (case-insensitive), become "***" in a copy. None (unset) stays None, and
+    None sections are omitted.
+    """
+    m: dict = {"code": "log", "event": "startup"}
+    if config is not None:
+        m["config"] = config
+    if args is not None:
+        m["args"] = args
+    if env is not None:
+        m["env"] = {k: "***" if v is not None and _is_secret_env_name(k) else v for k, v in env.items()}
+    return m
+
+
+def _is_secret_env_name(name: str) -> bool:
+    upper = name.upper()
+    return upper.endswith(_ENV_SECRET_SUFFIXES) or any(s in upper for s in _ENV_SECRET_SUBSTRINGS)
+
+
+def build_json_cursor(items: Any, next_cursor: str) -> dict:
+    """Build a cursor page {code: "ok", result: items, next_cursor, has_next}.
+
+    has_next is next_cursor != ""; an empty cursor marks the last page.
+    """
+    return {"code": "ok", "result": items, "next_cursor": next_cursor, "has_next": next_cursor != ""}
+
+
 def build_json(code: str, fields: Any, trace: Any = None) -> dict:
     """Build {code: "<custom>", ...fields, trace?}."""
     result = dict(fields) if isinstance(fields, dict) else {}
@@ -111,47 +191,45 @@ def _apply_redaction_policy(value: Any, redaction_policy: RedactionPolicy) -> No
     _redact_secrets(value)
 
 
+_SIZE_NUMBER = re.compile(r"[0-9]+\.?[0-9]*|\.[0-9]+")
+
+
 def parse_size(s: str) -> int | None:
     """Parse a human-readable size string into bytes.
 
-    Accepts bare numbers or numbers followed by a unit letter (B/K/M/G/T).
-    Case-insensitive. Trims whitespace. Returns None for invalid input.
+    Accepts bare numbers or numbers followed by a unit (B/K/M/G/T/P/E,
+    KB/MB/GB/TB/PB/EB or KiB/MiB/GiB/TiB/PiB/EiB, all binary), optionally
+    separated by whitespace ("10 MB"). Values past the uint64 range
+    (16 EiB) are rejected.
+    Case-insensitive. Trims whitespace. Numbers are plain decimals: signs,
+    underscores and scientific notation ("1e3") are rejected. Returns None
+    for invalid input.
     """
-    _multipliers = {"b": 1, "k": 1024, "m": 1024**2, "g": 1024**3, "t": 1024**4}
+    _multipliers = {
+        "k": 1024, "m": 1024**2, "g": 1024**3, "t": 1024**4, "p": 1024**5, "e": 1024**6,
+    }
     _max_u64 = (1 << 64) - 1
-    s = s.strip()
-    if not s:
-        return None
-    last = s[-1].lower()
-    if last in _multipliers:
-        num_str = s[:-1]
-        mult = _multipliers[last]
-    elif last.isdigit() or last == ".":
-        num_str = s
-        mult = 1
-    else:
-        return None
-    if not num_str:
+    num_str = s.strip().lower()
+    mult = 1
+    if num_str.endswith("b"):
+        num_str = num_str[:-1]
+        if len(num_str) >= 2 and num_str[-1] == "i" and num_str[-2] in _multipliers:
+            num_str = num_str[:-1]
+    if num_str and num_str[-1] in _multipliers:
+        mult = _multipliers[num_str[-1]]
+        num_str = num_str[:-1]
+    num_str = num_str.rstrip(" \t")
+    if not _SIZE_NUMBER.fullmatch(num_str):
         return None
-    try:
+    if "." not in num_str:
         n = int(num_str)
-        if n < 0:
-            return None
         if n > _max_u64 // mult:
             return None
         return n * mult
-    except ValueError:
-        pass
-    try:
-        f = float(num_str)
-        if f < 0 or not math.isfinite(f):
-            return None
-        result = f * mult
-        if not math.isfinite(result) or result > _max_u64:
-            return None
-        return int(result)
-    except (ValueError, OverflowError):
+    result = float(num_str) * mult
+    if not math.isfinite(result) or result > _max_u64:
         return None
+    return int(result)
 
 
 # ═══════════════════════════════════════════
@@ -255,8 +333,58 @@ def _as_non_neg_int(value: Any) -> int | None:
     return None
 
 
+def _format_cents(n: int) -> tuple[str, str]:
+    """Split cents into a sign and a grouped major amount: -123456 → ("-", "1,234.56")."""
+    sign = "-" if n < 0 else ""
+    n = abs(n)
+    return sign, f"{_format_with_commas(n // 100)}.{n % 100:02d}"
+
+
+# Numeric suffixes that accept one trailing digit as decimal places: latency_ms2.
+_PRECISION_SUFFIXES = ("_percent", "_ratio", "_btc", "_ms")
+
+
+def _try_precision_suffix(key: str, value: Any) -> tuple[str, str] | None:
+    """Format keys like "latency_ms2": the bare suffix's unit, rounded to the digit."""
+    if not key or key[-1] not in "0123456789":
+        return None
+    d = int(key[-1])
+    for suffix in _PRECISION_SUFFIXES:
+        stripped = _strip_suffix_ci(key[:-1], suffix)
+        if stripped is None:
+            continue
+        if not _is_number(value):
+            return None
+        n = float(value)
+        if suffix == "_percent":
+            return stripped, f"{n:.{d}f}%"
+        if suffix == "_ratio":
+            return stripped, f"{n * 100:.{d}f}%"
+        if suffix == "_btc":
+            return stripped, f"{n:.{d}f} BTC"
+        if abs(n) >= 1000:
+            return stripped, f"{n / 1000:.{d}f}s"
+        return stripped, f"{n:.{d}f}ms"
+    return None
+
+
+# E.164: "+", then 1-15 digits, the first non-zero.
+_E164_RE = re.compile(r"\+[1-9][0-9]{0,14}")
+
+# Explicit power-of-1024 size suffixes: integers scaled to bytes, rendered like _bytes.
+_BINARY_UNIT_SUFFIXES = (("_kib", 1 << 10), ("_mib", 1 << 20), ("_gib", 1 << 30), ("_tib", 1 << 40))
+
+# Longest first, so "_khz" is not read as "_hz".
+_FREQUENCY_SUFFIXES = (("_ghz", "GHz"), ("_mhz", "MHz"), ("_khz", "kHz"), ("_hz", "Hz"))
+
+
 def _try_process_field(key: str, value: Any) -> tuple[str, str] | None:
     """Try suffix-driven processing. Returns (stripped_key, formatted_value) or None."""
+    # Group 0: numeric suffixes with an inline precision digit (latency_ms2)
+    result = _try_precision_suffix(key, value)
+    if result is not None:
+        return result
+
     # Group 1: compound timestamp suffixes
     stripped = _strip_suffix_ci(key, "_epoch_ms")
     if stripped is not None:
@@ -280,22 +408,25 @@ def _try_process_field(key: str, value: Any) -> tuple[str, str] | None:
     # Group 2: compound currency suffixes
     stripped = _strip_suffix_ci(key, "_usd_cents")
     if stripped is not None:
-        n = _as_non_neg_int(value)
+        n = _as_int(value)
         if n is not None:
-            return stripped, f"${n // 100}.{n % 100:02d}"
+            sign, amount = _format_cents(n)
+            return stripped, f"{sign}${amount}"
         return None
     stripped = _strip_suffix_ci(key, "_eur_cents")
     if stripped is not None:
-        n = _as_non_neg_int(value)
+        n = _as_int(value)
         if n is not None:
-            return stripped, f"\u20ac{n // 100}.{n % 100:02d}"
+            sign, amount = _format_cents(n)
+            return stripped, f"{sign}\u20ac{amount}"
         return None
     gc = _try_strip_generic_cents(key)
     if gc is not None:
         stripped, code = gc
-        n = _as_non_neg_int(value)
+        n = _as_int(value)
         if n is not None:
-            return stripped, f"{n // 100}.{n % 100:02d} {code.upper()}"
+            sign, amount = _format_cents(n)
+            return stripped, f"{sign}{amount} {code.upper()}"
         return None
 
     # Group 3: multi-char suffixes
@@ -304,6 +435,25 @@ def _try_process_field(key: str, value: Any) -> tuple[str, str] | None:
         if isinstance(value, str):
             return stripped, value
         return None
+    stripped = _strip_suffix_ci(key, "_e164")
+    if stripped is not None:
+        if isinstance(value, str) and _E164_RE.fullmatch(value):
+            return stripped, value
+        return None
+    stripped = _strip_suffix_ci(key, "_base64")
+    if stripped is not None:
+        if isinstance(value, str):
+            decoded = _decode_base64(value)
+            if decoded is not None:
+                text = _printable_text(decoded)
+                return stripped, value if text is None else text
+        return None
+    stripped = _strip_suffix_ci(key, "_hex")
+    if stripped is not None:
+        n = _as_non_neg_int(value)
+        if n is not None and n < 2**63:
+            return stripped, f"0x{n:x}"
+        return None
     stripped = _strip_suffix_ci(key, "_minutes")
     if stripped is not None:
         if _is_number(value):
@@ -319,6 +469,18 @@ def _try_process_field(key: str, value: Any) -> tuple[str, str] | None:
         if _is_number(value):
             return stripped, f"{_plain_scalar(value)} days"
         return None
+    for suffix in ("_rate_per_second", "_rps"):
+        stripped = _strip_suffix_ci(key, suffix)
+        if stripped is not None:
+            if _is_number(value):
+                return stripped, _format_rate(value)
+            return None
+    for suffix, unit in _FREQUENCY_SUFFIXES:
+        stripped = _strip_suffix_ci(key, suffix)
+        if stripped is not None:
+            if _is_number(value):
+                return stripped, f"{_plain_scalar(value)} {unit}"
+            return None
 
     # Group 4: single-unit suffixes
     stripped = _strip_suffix_ci(key, "_msats")
@@ -336,12 +498,29 @@ def _try_process_field(key: str, value: Any) -> tuple[str, str] | None:
         n = _as_int(value)
         if n is not None:
             return stripped, _format_bytes_human(n)
+        # Fractional byte counts (e.g. averages) round half away from zero.
+        if _is_number(value) and math.isfinite(value):
+            r = int(math.copysign(math.floor(abs(value) + 0.5), value))
+            if -(2**63) <= r < 2**63:
+                return stripped, _format_bytes_human(r)
         return None
+    for suffix, mult in _BINARY_UNIT_SUFFIXES:
+        stripped = _strip_suffix_ci(key, suffix)
+        if stripped is not None:
+            n = _as_int(value)
+            if n is not None and -(2**63) <= n * mult < 2**63:
+                return stripped, _format_bytes_human(n * mult)
+            return None
     stripped = _strip_suffix_ci(key, "_percent")
     if stripped is not None:
         if _is_number(value):
             return stripped, f"{_plain_scalar(value)}%"
         return None
+    stripped = _strip_suffix_ci(key, "_ratio")
+    if stripped is not None:
+        if _is_number(value):
+            return stripped, _format_ratio(value)
+        return None
     stripped = _strip_suffix_ci(key, "_secret")
     if stripped is not None:
         return stripped, "***"
@@ -440,6 +619,54 @@ def _format_ms_value(value: Any) -> str | None:
     return f"{_plain_scalar(value)}ms"
 
 
+def _decode_base64(s: str) -> bytes | None:
+    """Decode standard or URL-safe base64, padded or not. None if invalid."""
+    if not s or "\r" in s or "\n" in s:
+        return None
+    if "=" not in s:
+        s += "=" * (-len(s) % 4)
+    for altchars, other in ((None, "-_"), (b"-_", "+/")):
+        if any(c in s for c in other):
+            continue
+        try:
+            return base64.b64decode(s, altchars=altchars, validate=True)
+        except (binascii.Error, ValueError):
+            continue
+    return None
+
+
+def _printable_text(b: bytes) -> str | None:
+    """Return b as text if it is UTF-8 with no control characters but \\n, \\t, \\r."""
+    try:
+        text = b.decode("utf-8")
+    except UnicodeDecodeError:
+        return None
+    for c in text:
+        cp = ord(c)
+        if (cp < 0x20 or 0x7F <= cp <= 0x9F) and c not in "\n\t\r":
+            return None
+    return text
+
+
+def _format_ratio(n: float) -> str:
+    """Format a fraction as a percentage to 9 decimals, zeros trimmed: 0.875 → "87.5%"."""
+    return f"{n * 100:.9f}".rstrip("0").rstrip(".") + "%"
+
+
+def _format_rate(n: float) -> str:
+    """Format a per-second rate with base-1000 promotion: 1523.4 → "1.5k/s"."""
+    sign = "-" if n < 0 else ""
+    n = abs(n)
+    units = ("", "k", "M", "G", "T")
+    i = 0
+    while i < len(units) - 1 and math.floor(n * 10 + 0.5) / 10 >= 1000:
+        n /= 1000
+        i += 1
+    if n == 0:
+        sign = ""
+    return f"{sign}{n:.1f}{units[i]}/s"
+
+
 def _format_rfc3339_ms(ms: int) -> str:
     try:
         dt = datetime.fromtimestamp(ms / 1000, tz=timezone.utc)
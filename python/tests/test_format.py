@@ -6,6 +6,12 @@ import os
 from agent_first_data import (
     build_json_ok,
     build_json_error,
+    build_json_error_code,
+    build_json_errors,
+    build_json_warning,
+    build_json_cursor,
+    build_json_startup,
+    build_json_batch,
     build_json,
     RedactionPolicy,
     internal_redact_secrets,
@@ -62,6 +68,28 @@ def test_protocol_fixtures():
             result = build_json_error(args["message"], hint=args.get("hint"), trace=args["trace"])
         elif typ == "status":
             result = build_json(args["code"], args.get("fields"))
+        elif typ == "batch":
+            result = build_json_batch(args["results"])
+        elif typ == "batch_trace":
+            result = build_json_batch(args["results"], trace=args["trace"])
+        elif typ == "startup":
+            result = build_json_startup(args.get("config"), args.get("args"), args.get("env"))
+        elif typ == "warning":
+            result = build_json_warning(args["message"], args["warning_code"])
+        elif typ == "warning_trace":
+            result = build_json_warning(args["message"], args["warning_code"], trace=args["trace"])
+        elif typ == "cursor":
+            result = build_json_cursor(args["items"], args["next_cursor"])
+        elif typ == "error_code":
+            result = build_json_error_code(args["message"], args["error_code"], args["retryable"])
+        elif typ == "error_code_trace":
+            result = build_json_error_code(
+                args["message"], args["error_code"], args["retryable"], trace=args["trace"]
+            )
+        elif typ == "errors":
+            result = build_json_errors(args["errors"])
+        elif typ == "errors_trace":
+            result = build_json_errors(args["errors"], trace=args["trace"])
         else:
             raise ValueError(f"unknown type: {typ}")
 
@@ -156,3 +184,10 @@ def test_output_json_with_none_keeps_secrets():
     )
     parsed = json.loads(out)
     assert parsed["api_key_secret"] == "sk-live-123"
+
+
+def test_output_floats_match_json():
+    for f in [1e21, 0.1, 1e-7, -2.5e30, 0.0, 42.5]:
+        want = json.dumps(f)
+        assert output_plain({"v": f}) == f"v={want}"
+        assert output_yaml({"v": f}) == f"---\nv: {want}"
@@ -39,6 +39,144 @@ pub fn build_json_error(message: &str, hint: Option<&str>, trace: Option<Value>)
     Value::Object(obj)
 }
 
+/// Build `{code: "error", error: message, error_code, retryable, trace?: ...}`.
+pub fn build_json_error_code(
+    message: &str,
+    error_code: &str,
+    retryable: bool,
+    trace: Option<Value>,
+) -> Value {
+    let mut obj = serde_json::Map::new();
+    obj.insert("code".to_string(), Value::String("error".to_string()));
+    obj.insert("error".to_string(), Value::String(message.to_string()));
+    obj.insert(
+        "error_code".to_string(),
+        Value::String(error_code.to_string()),
+    );
+    obj.insert("retryable".to_string(), Value::Bool(retryable));
+    if let Some(t) = trace {
+        obj.insert("trace".to_string(), t);
+    }
+    Value::Object(obj)
+}
+
+/// Build `{code: "error", error: "<first> (+N more)", errors, retryable: false, trace?: ...}`.
+pub fn build_json_errors(errors: &[&str], trace: Option<Value>) -> Value {
+    let mut summary = errors.first().copied().unwrap_or_default().to_string();
+    if errors.len() > 1 {
+        summary.push_str(&format!(" (+{} more)", errors.len() - 1));
+    }
+    let mut obj = serde_json::Map::new();
+    obj.insert("code".to_string(), Value::String("error".to_string()));
+    obj.insert("error".to_string(), Value::String(summary));
+    obj.insert(
+        "errors".to_string(),
+        Value::Array(
+            errors
+                .iter()
+                .map(|e| Value::String(e.to_string()))
+                .collect(),
+        ),
+    );
+    obj.insert("retryable".to_string(), Value::Bool(false));
+    if let Some(t) = trace {
+        obj.insert("trace".to_string(), t);
+    }
+    Value::Object(obj)
+}
+
+/// Build `{code: "warning", warning: message, warning_code, retryable: false, trace?: ...}`.
+pub fn build_json_warning(message: &str, warning_code: &str, trace: Option<Value>) -> Value {
+    let mut obj = serde_json::Map::new();
+    obj.insert("code".to_string(), Value::String("warning".to_string()));
+    obj.insert("warning".to_string(), Value::String(message.to_string()));
+    obj.insert(
+        "warning_code".to_string(),
+        Value::String(warning_code.to_string()),
+    );
+    obj.insert("retryable".to_string(), Value::Bool(false));
+    if let Some(t) = trace {
+        obj.insert("trace".to_string(), t);
+    }
+    Value::Object(obj)
+}
+
+/// Build `{code: "batch", results, count, failed_count, trace?: ...}`.
+///
+/// `failed_count` counts results whose code is `"error"`.
+pub fn build_json_batch(results: Vec<Value>, trace: Option<Value>) -> Value {
+    let failed = results
+        .iter()
+        .filter(|r| r.get("code").and_then(Value::as_str) == Some("error"))
+        .count();
+    let mut obj = serde_json::Map::new();
+    obj.insert("code".to_string(), Value::String("batch".to_string()));
+    obj.insert("count".to_string(), Value::from(results.len()));
+    obj.insert("failed_count".to_string(), Value::from(failed));
+    obj.insert("results".to_string(), Value::Array(results));
+    if let Some(t) = trace {
+        obj.insert("trace".to_string(), t);
+    }
+    Value::Object(obj)
+}
+
+const ENV_SECRET_SUFFIXES: [&str; 3] = ["_KEY", "_TOKEN", "_SECRET"];
+const ENV_SECRET_SUBSTRINGS: [&str; 1] = ["PASSWORD"];
+
+/// Build the startup event `{code: "log", event: "startup", config?, args?, env?}`.
+///
+/// Env values whose names end in `_KEY`, `_TOKEN` or `_SECRET`, or contain
+/// `PASSWORD` (case-insensitive), become `"***"` in a copy. `null` (unset)
+/// stays `null`, and `None` sections are omitted.
+pub fn build_json_startup(
+    config: Option<Value>,
+    args: Option<Value>,
+    env: Option<&serde_json::Map<String, Value>>,
+) -> Value {
+    let mut obj = serde_json::Map::new();
+    obj.insert("code".to_string(), Value::String("log".to_string()));
+    obj.insert("event".to_string(), Value::String("startup".to_string()));
+    if let Some(c) = config {
+        obj.insert("config".to_string(), c);
+    }
+    if let Some(a) = args {
+        obj.insert("args".to_string(), a);
+    }
+    if let Some(env) = env {
+        let masked = env
+            .iter()
+            .map(|(k, v)| {
+                let v = if !v.is_null() && is_secret_env_name(k) {
+                    Value::String("***".to_string())
+                } else {
+                    v.clone()
+                };
+                (k.clone(), v)
+            })
+            .collect();
+        obj.insert("env".to_string(), Value::Object(masked));
+    }
+    Value::Object(obj)
+}
+
+fn is_secret_env_name(name: &str) -> bool {
+    let upper = name.to_uppercase();
+    ENV_SECRET_SUFFIXES.iter().any(|s| upper.ends_with(s))
+        || ENV_SECRET_SUBSTRINGS.iter().any(|s| upper.contains(s))
+}
+
+/// Build a cursor page `{code: "ok", result: items, next_cursor, has_next}`.
+///
+/// `has_next` is `!next_cursor.is_empty()`; an empty cursor marks the last page.
+pub fn build_json_cursor(items: Value, next_cursor: &str) -> Value {
+    serde_json::json!({
+        "code": "ok",
+        "result": items,
+        "next_cursor": next_cursor,
+        "has_next": !next_cursor.is_empty(),
+    })
+}
+
 /// Build `{code: "<custom>", ...fields, trace?: ...}`.
 pub fn build_json(code: &str, fields: Value, trace: Option<Value>) -> Value {
     let mut obj = match fields {
@@ -126,36 +264,38 @@ pub fn internal_redact_secrets(value: &mut Value) {
 
 /// Parse a human-readable size string into bytes.
 ///
-/// Accepts bare number, or number followed by unit letter
-/// (`B`, `K`, `M`, `G`, `T`). Case-insensitive. Trims whitespace.
-/// Returns `None` for invalid or negative input.
+/// Accepts bare number, or number followed by a unit (`B`, `K`, `M`,
+/// `G`, `T`, `P`, `E`, `KB`…`EB` or `KiB`…`EiB`, all binary), optionally
+/// separated by whitespace (`"10 MB"`). Values past `u64::MAX` (16 EiB)
+/// are rejected rather than wrapped. Case-insensitive. Trims whitespace.
+/// Numbers are plain decimals: signs, underscores and scientific
+/// notation (`"1e3"`) are rejected. Returns `None` for invalid input.
 pub fn parse_size(s: &str) -> Option<u64> {
-    let s = s.trim();
-    if s.is_empty() {
-        return None;
+    let lower = s.trim().to_ascii_lowercase();
+    let mut num_str = lower.as_str();
+    if let Some(rest) = num_str.strip_suffix('b') {
+        num_str = rest;
+        if let Some(rest) = num_str.strip_suffix('i') {
+            if rest.bytes().last().and_then(size_unit_exponent).is_some() {
+                num_str = rest;
+            }
+        }
     }
-    let last = *s.as_bytes().last()?;
-    let (num_str, mult) = match last {
-        b'B' | b'b' => (&s[..s.len() - 1], 1u64),
-        b'K' | b'k' => (&s[..s.len() - 1], 1024),
-        b'M' | b'm' => (&s[..s.len() - 1], 1024 * 1024),
-        b'G' | b'g' => (&s[..s.len() - 1], 1024 * 1024 * 1024),
-        b'T' | b't' => (&s[..s.len() - 1], 1024u64 * 1024 * 1024 * 1024),
-        b'0'..=b'9' | b'.' => (s, 1),
-        _ => return None,
-    };
-    if num_str.is_empty() {
-        return None;
+    let mut mult = 1u64;
+    if let Some(exp) = num_str.bytes().last().and_then(size_unit_exponent) {
+        mult = 1024u64.pow(exp);
+        num_str = &num_str[..num_str.len() - 1];
     }
-    if let Ok(n) = num_str.parse::<u64>() {
-        return n.checked_mul(mult);
+    let num_str = num_str.trim_end_matches([' ', '\t']);
+    if !is_size_number(num_str) {
+        return None;
     }
     // Integer overflow must not silently fall back to float parsing.
-    if !num_str.contains('.') && !num_str.contains('e') && !num_str.contains('E') {
-        return None;
+    if !num_str.contains('.') {
+        return num_str.parse::<u64>().ok()?.checked_mul(mult);
     }
     let f: f64 = num_str.parse().ok()?;
-    if f < 0.0 || f.is_nan() || f.is_infinite() {
+    if f.is_infinite() {
         return None;
     }
     let result = f * mult as f64;
@@ -165,6 +305,34 @@ pub fn parse_size(s: &str) -> Option<u64> {
     Some(result as u64)
 }
 
+/// Power of 1024 for a lowercase `parse_size` unit letter.
+fn size_unit_exponent(c: u8) -> Option<u32> {
+    match c {
+        b'k' => Some(1),
+        b'm' => Some(2),
+        b'g' => Some(3),
+        b't' => Some(4),
+        b'p' => Some(5),
+        b'e' => Some(6),
+        _ => None,
+    }
+}
+
+/// Plain decimal as `parse_size` accepts it: digits with an optional
+/// fractional part (`"10"`, `"1.5"`, `".5"`, `"5."`).
+fn is_size_number(s: &str) -> bool {
+    let mut digits = 0;
+    let mut dot = false;
+    for c in s.bytes() {
+        match c {
+            b'0'..=b'9' => digits += 1,
+            b'.' if !dot => dot = true,
+            _ => return false,
+        }
+    }
+    digits > 0
+}
+
 // ═══════════════════════════════════════════
 // Public API: CLI Helpers
 // ═══════════════════════════════════════════
@@ -344,7 +512,53 @@ fn try_strip_generic_cents(key: &str) -> Option<(String, String)> {
 
 /// Try suffix-driven processing. Returns Some((stripped_key, formatted_value))
 /// when suffix matches and type is valid. None for no match or type mismatch.
+/// Numeric suffixes that accept one trailing digit as decimal places: `latency_ms2`.
+const PRECISION_SUFFIXES: [&str; 4] = ["_percent", "_ratio", "_btc", "_ms"];
+
+/// Format keys like `latency_ms2`: the bare suffix's unit, rounded to the digit.
+fn try_precision_suffix(key: &str, value: &Value) -> Option<(String, String)> {
+    let last = key.chars().last().filter(char::is_ascii_digit)?;
+    let d = last.to_digit(10)? as usize;
+    let base = &key[..key.len() - 1];
+    for suffix in PRECISION_SUFFIXES {
+        let Some(stripped) = strip_suffix_ci(base, suffix) else {
+            continue;
+        };
+        let n = value.as_f64()?;
+        let formatted = match suffix {
+            "_percent" => format!("{n:.d$}%"),
+            "_ratio" => format!("{:.d$}%", n * 100.0),
+            "_btc" => format!("{n:.d$} BTC"),
+            _ if n.abs() >= 1000.0 => format!("{:.d$}s", n / 1000.0),
+            _ => format!("{n:.d$}ms"),
+        };
+        return Some((stripped, formatted));
+    }
+    None
+}
+
+/// Explicit power-of-1024 size suffixes: integers scaled to bytes, rendered like `_bytes`.
+const BINARY_UNIT_SUFFIXES: [(&str, i64); 4] = [
+    ("_kib", 1 << 10),
+    ("_mib", 1 << 20),
+    ("_gib", 1 << 30),
+    ("_tib", 1 << 40),
+];
+
+/// Frequency suffixes, longest first so `_khz` is not read as `_hz`.
+const FREQUENCY_SUFFIXES: [(&str, &str); 4] = [
+    ("_ghz", "GHz"),
+    ("_mhz", "MHz"),
+    ("_khz", "kHz"),
+    ("_hz", "Hz"),
+];
+
 fn try_process_field(key: &str, value: &Value) -> Option<(String, String)> {
+    // Group 0: numeric suffixes with an inline precision digit (latency_ms2)
+    if let Some(result) = try_precision_suffix(key, value) {
+        return Some(result);
+    }
+
     // Group 1: compound timestamp suffixes
     if let Some(stripped) = strip_suffix_ci(key, "_epoch_ms") {
         return value.as_i64().map(|ms| (stripped, format_rfc3339_ms(ms)));
@@ -362,20 +576,18 @@ fn try_process_field(key: &str, value: &Value) -> Option<(String, String)> {
 
     // Group 2: compound currency suffixes
     if let Some(stripped) = strip_suffix_ci(key, "_usd_cents") {
-        return value
-            .as_u64()
-            .map(|n| (stripped, format!("${}.{:02}", n / 100, n % 100)));
+        return cents_value(value)
+            .map(|(sign, n)| (stripped, format!("{sign}${}", format_cents(n))));
     }
     if let Some(stripped) = strip_suffix_ci(key, "_eur_cents") {
-        return value
-            .as_u64()
-            .map(|n| (stripped, format!("€{}.{:02}", n / 100, n % 100)));
+        return cents_value(value)
+            .map(|(sign, n)| (stripped, format!("{sign}€{}", format_cents(n))));
     }
     if let Some((stripped, code)) = try_strip_generic_cents(key) {
-        return value.as_u64().map(|n| {
+        return cents_value(value).map(|(sign, n)| {
             (
                 stripped,
-                format!("{}.{:02} {}", n / 100, n % 100, code.to_uppercase()),
+                format!("{sign}{} {}", format_cents(n), code.to_uppercase()),
             )
         });
     }
@@ -384,6 +596,26 @@ fn try_process_field(key: &str, value: &Value) -> Option<(String, String)> {
     if let Some(stripped) = strip_suffix_ci(key, "_rfc3339") {
         return value.as_str().map(|s| (stripped, s.to_string()));
     }
+    if let Some(stripped) = strip_suffix_ci(key, "_e164") {
+        return value
+            .as_str()
+            .filter(|s| is_e164(s))
+            .map(|s| (stripped, s.to_string()));
+    }
+    if let Some(stripped) = strip_suffix_ci(key, "_base64") {
+        let s = value.as_str()?;
+        let decoded = decode_base64(s)?;
+        return Some((
+            stripped,
+            printable_text(decoded).unwrap_or_else(|| s.to_string()),
+        ));
+    }
+    if let Some(stripped) = strip_suffix_ci(key, "_hex") {
+        return value
+            .as_i64()
+            .filter(|n| *n >= 0)
+            .map(|n| (stripped, format!("0x{n:x}")));
+    }
     if let Some(stripped) = strip_suffix_ci(key, "_minutes") {
         return value
             .is_number()
@@ -399,6 +631,18 @@ fn try_process_field(key: &str, value: &Value) -> Option<(String, String)> {
             .is_number()
             .then(|| (stripped, format!("{} days", number_str(value))));
     }
+    for suffix in ["_rate_per_second", "_rps"] {
+        if let Some(stripped) = strip_suffix_ci(key, suffix) {
+            return value.as_f64().map(|n| (stripped, format_rate(n)));
+        }
+    }
+    for (suffix, unit) in FREQUENCY_SUFFIXES {
+        if let Some(stripped) = strip_suffix_ci(key, suffix) {
+            return value
+                .is_number()
+                .then(|| (stripped, format!("{} {unit}", number_str(value))));
+        }
+    }
 
     // Group 4: single-unit suffixes
     if let Some(stripped) = strip_suffix_ci(key, "_msats") {
@@ -412,13 +656,30 @@ fn try_process_field(key: &str, value: &Value) -> Option<(String, String)> {
             .then(|| (stripped, format!("{}sats", number_str(value))));
     }
     if let Some(stripped) = strip_suffix_ci(key, "_bytes") {
-        return value.as_i64().map(|n| (stripped, format_bytes_human(n)));
+        if let Some(n) = value.as_i64() {
+            return Some((stripped, format_bytes_human(n)));
+        }
+        // Fractional byte counts (e.g. averages) round half away from zero.
+        let r = value.as_f64()?.round();
+        return (r >= i64::MIN as f64 && r < i64::MAX as f64)
+            .then(|| (stripped, format_bytes_human(r as i64)));
+    }
+    for (suffix, mult) in BINARY_UNIT_SUFFIXES {
+        if let Some(stripped) = strip_suffix_ci(key, suffix) {
+            return value
+                .as_i64()
+                .and_then(|n| n.checked_mul(mult))
+                .map(|n| (stripped, format_bytes_human(n)));
+        }
     }
     if let Some(stripped) = strip_suffix_ci(key, "_percent") {
         return value
             .is_number()
             .then(|| (stripped, format!("{}%", number_str(value))));
     }
+    if let Some(stripped) = strip_suffix_ci(key, "_ratio") {
+        return value.as_f64().map(|n| (stripped, format_ratio(n)));
+    }
     if let Some(stripped) = strip_suffix_ci(key, "_secret") {
         return Some((stripped, "***".to_string()));
     }
@@ -528,6 +789,80 @@ fn format_ms_value(value: &Value) -> Option<String> {
     }
 }
 
+/// E.164: `+`, then 1-15 digits, the first non-zero.
+fn is_e164(s: &str) -> bool {
+    match s.strip_prefix('+') {
+        Some(digits) => {
+            (1..=15).contains(&digits.len())
+                && !digits.starts_with('0')
+                && digits.bytes().all(|c| c.is_ascii_digit())
+        }
+        None => false,
+    }
+}
+
+/// Decode standard or URL-safe base64, padded or not. `None` if invalid.
+fn decode_base64(s: &str) -> Option<Vec<u8>> {
+    let data = s.trim_end_matches('=');
+    let pad = s.len() - data.len();
+    if data.is_empty() || pad > 2 || (pad > 0 && s.len() % 4 != 0) || data.len() % 4 == 1 {
+        return None;
+    }
+    let url_safe = data.contains(['-', '_']);
+    let mut out = Vec::with_capacity(data.len() * 3 / 4);
+    let mut acc: u32 = 0;
+    let mut bits = 0;
+    for c in data.bytes() {
+        let v = match c {
+            b'A'..=b'Z' => c - b'A',
+            b'a'..=b'z' => c - b'a' + 26,
+            b'0'..=b'9' => c - b'0' + 52,
+            b'+' if !url_safe => 62,
+            b'/' if !url_safe => 63,
+            b'-' => 62,
+            b'_' => 63,
+            _ => return None,
+        };
+        acc = (acc << 6) | u32::from(v);
+        bits += 6;
+        if bits >= 8 {
+            bits -= 8;
+            out.push((acc >> bits) as u8);
+        }
+    }
+    Some(out)
+}
+
+/// Return `b` as text if it is UTF-8 with no control characters but `\n`, `\t`, `\r`.
+fn printable_text(b: Vec<u8>) -> Option<String> {
+    let text = String::from_utf8(b).ok()?;
+    text.chars()
+        .all(|c| !c.is_control() || matches!(c, '\n' | '\t' | '\r'))
+        .then_some(text)
+}
+
+/// Format a fraction as a percentage to 9 decimals, zeros trimmed: 0.875 → `87.5%`.
+fn format_ratio(n: f64) -> String {
+    let formatted = format!("{:.9}", n * 100.0);
+    format!("{}%", formatted.trim_end_matches('0').trim_end_matches('.'))
+}
+
+/// Format a per-second rate with base-1000 promotion: 1523.4 → `1.5k/s`.
+fn format_rate(n: f64) -> String {
+    const UNITS: [&str; 5] = ["", "k", "M", "G", "T"];
+    let mut sign = if n < 0.0 { "-" } else { "" };
+    let mut n = n.abs();
+    let mut i = 0;
+    while i < UNITS.len() - 1 && (n * 10.0).round() / 10.0 >= 1000.0 {
+        n /= 1000.0;
+        i += 1;
+    }
+    if n == 0.0 {
+        sign = "";
+    }
+    format!("{sign}{n:.1}{}/s", UNITS[i])
+}
+
 /// Convert unix milliseconds (signed) to RFC 3339 with UTC timezone.
 fn format_rfc3339_ms(ms: i64) -> String {
     use chrono::{DateTime, Utc};
@@ -563,6 +898,20 @@ fn format_bytes_human(bytes: i64) -> String {
     }
 }
 
+/// Cents as a grouped major amount: `123456` → `"1,234.56"`.
+fn format_cents(n: u64) -> String {
+    format!("{}.{:02}", format_with_commas(n / 100), n % 100)
+}
+
+/// Split an integer cents value into a sign (placed before the currency
+/// symbol) and its magnitude. Non-integers return `None`.
+fn cents_value(value: &Value) -> Option<(&'static str, u64)> {
+    match value.as_u64() {
+        Some(n) => Some(("", n)),
+        None => value.as_i64().map(|n| ("-", n.unsigned_abs())),
+    }
+}
+
 /// Format a number with thousands separators.
 fn format_with_commas(n: u64) -> String {
     let s = n.to_string();
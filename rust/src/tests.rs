@@ -57,6 +57,47 @@ fn test_protocol_fixtures() {
                 let fields = args["fields"].clone();
                 build_json(code, fields, None)
             }
+            "batch" | "batch_trace" => build_json_batch(
+                args["results"]
+                    .as_array()
+                    .cloned()
+                    .expect("missing results"),
+                args.get("trace").cloned(),
+            ),
+            "startup" => build_json_startup(
+                args.get("config").cloned(),
+                args.get("args").cloned(),
+                args.get("env").and_then(Value::as_object),
+            ),
+            "warning" => build_json_warning(
+                args["message"].as_str().expect("missing message"),
+                args["warning_code"].as_str().expect("missing warning_code"),
+                None,
+            ),
+            "warning_trace" => build_json_warning(
+                args["message"].as_str().expect("missing message"),
+                args["warning_code"].as_str().expect("missing warning_code"),
+                Some(args["trace"].clone()),
+            ),
+            "cursor" => build_json_cursor(
+                args["items"].clone(),
+                args["next_cursor"].as_str().expect("missing next_cursor"),
+            ),
+            "error_code" | "error_code_trace" => build_json_error_code(
+                args["message"].as_str().expect("missing message"),
+                args["error_code"].as_str().expect("missing error_code"),
+                args["retryable"].as_bool().expect("missing retryable"),
+                args.get("trace").cloned(),
+            ),
+            "errors" | "errors_trace" => {
+                let errors: Vec<&str> = args["errors"]
+                    .as_array()
+                    .expect("missing errors")
+                    .iter()
+                    .map(|e| e.as_str().expect("error must be string"))
+                    .collect();
+                build_json_errors(&errors, args.get("trace").cloned())
+            }
             other => panic!("unknown protocol type: {other}"),
         };
         if let Some(expected) = case.get("expected") {
@@ -857,12 +898,6 @@ fn plain_nested_secrets() {
 // Wrong type -> raw value with ORIGINAL key
 // ═══════════════════════════════════════════
 
-#[test]
-fn fallthrough_bytes_float() {
-    let out = output_plain(&json!({"size_bytes": 1024.5}));
-    assert_eq!(out, "size_bytes=1024.5");
-}
-
 #[test]
 fn fallthrough_bytes_string() {
     let out = output_plain(&json!({"size_bytes": "unknown"}));
@@ -912,15 +947,30 @@ fn fallthrough_s_string() {
 }
 
 #[test]
-fn fallthrough_usd_cents_negative() {
-    let out = output_plain(&json!({"refund_usd_cents": -499}));
-    assert_eq!(out, "refund_usd_cents=-499");
+fn fallthrough_usd_cents_float() {
+    let out = output_plain(&json!({"refund_usd_cents": -4.99}));
+    assert_eq!(out, "refund_usd_cents=-4.99");
+}
+
+#[test]
+fn floats_match_json_in_plain_and_yaml() {
+    for f in [1e21, 0.1, 1e-7, -2.5e30, 0.0, 42.5] {
+        let want = serde_json::to_string(&f).unwrap();
+        assert_eq!(output_plain(&json!({"v": f})), format!("v={want}"));
+        assert_eq!(output_yaml(&json!({"v": f})), format!("---\nv: {want}"));
+    }
+}
+
+#[test]
+fn plain_fmt_bytes_fractional_rounds() {
+    let out = output_plain(&json!({"size_bytes": 1024.5}));
+    assert_eq!(out, "size=1.0KB");
 }
 
 #[test]
-fn fallthrough_eur_cents_negative() {
+fn plain_fmt_eur_cents_negative() {
     let out = output_plain(&json!({"refund_eur_cents": -100}));
-    assert_eq!(out, "refund_eur_cents=-100");
+    assert_eq!(out, "refund=-€1.00");
 }
 
 #[test]
@@ -16,6 +16,7 @@ echo "[1/4] Rust (policy + tests)"
 echo ""
 echo "[2/4] Go"
 (cd "$ROOTPATH/go" && go test -v ./...)
+(cd "$ROOTPATH/go/otel" && go test -v ./...)
 
 echo ""
 echo "[3/4] Python"
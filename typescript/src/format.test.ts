@@ -10,6 +10,12 @@ import { fileURLToPath } from "node:url";
 import {
   buildJsonOk,
   buildJsonError,
+  buildJsonErrorCode,
+  buildJsonErrors,
+  buildJsonWarning,
+  buildJsonCursor,
+  buildJsonStartup,
+  buildJsonBatch,
   buildJson,
   internalRedactSecrets,
   RedactionPolicy,
@@ -55,6 +61,18 @@ describe("protocol fixtures", () => {
         case "error_hint": result = buildJsonError(args.message, args.hint); break;
         case "error_hint_trace": result = buildJsonError(args.message, args.hint, args.trace); break;
         case "status": result = buildJson(args.code, args.fields); break;
+        case "batch": result = buildJsonBatch(args.results); break;
+        case "batch_trace": result = buildJsonBatch(args.results, args.trace); break;
+        case "startup": result = buildJsonStartup(args.config, args.args, args.env); break;
+        case "warning": result = buildJsonWarning(args.message, args.warning_code); break;
+        case "warning_trace": result = buildJsonWarning(args.message, args.warning_code, args.trace); break;
+        case "cursor": result = buildJsonCursor(args.items, args.next_cursor); break;
+        case "error_code": result = buildJsonErrorCode(args.message, args.error_code, args.retryable); break;
+        case "error_code_trace":
+          result = buildJsonErrorCode(args.message, args.error_code, args.retryable, args.trace);
+          break;
+        case "errors": result = buildJsonErrors(args.errors); break;
+        case "errors_trace": result = buildJsonErrors(args.errors, args.trace); break;
         default: throw new Error(`unknown type: ${tc.type}`);
       }
       if (tc.expected) {
@@ -129,6 +147,16 @@ describe("output format fixtures", () => {
   }
 });
 
+describe("float formatting", () => {
+  it("writes floats in plain and yaml exactly as JSON does", () => {
+    for (const f of [1e21, 0.1, 1e-7, -2.5e30, 0, 42.5]) {
+      const want = JSON.stringify(f);
+      assert.equal(outputPlain({ v: f }), `v=${want}`);
+      assert.equal(outputYaml({ v: f }), `---\nv: ${want}`);
+    }
+  });
+});
+
 describe("parseSize safety", () => {
   it("returns null for unsafe integers", () => {
     assert.equal(parseSize("9007199254740993"), null);
@@ -31,6 +31,91 @@ export function buildJsonError(message: string, hint?: string, trace?: JsonValue
   return m;
 }
 
+/** Build {code: "error", error: message, error_code, retryable, trace?}. */
+export function buildJsonErrorCode(
+  message: string, errorCode: string, retryable: boolean, trace?: JsonValue,
+): JsonValue {
+  const m: Record<string, JsonValue> = {
+    code: "error", error: message, error_code: errorCode, retryable,
+  };
+  if (trace !== undefined) m.trace = trace;
+  return m;
+}
+
+/** Build {code: "error", error: "<first> (+N more)", errors, retryable: false, trace?}. */
+export function buildJsonErrors(errors: string[], trace?: JsonValue): JsonValue {
+  let summary = errors[0] ?? "";
+  if (errors.length > 1) summary += ` (+${errors.length - 1} more)`;
+  const m: Record<string, JsonValue> = {
+    code: "error", error: summary, errors: [...errors], retryable: false,
+  };
+  if (trace !== undefined) m.trace = trace;
+  return m;
+}
+
+/** Build {code: "warning", warning: message, warning_code, retryable: false, trace?}. */
+export function buildJsonWarning(message: string, warningCode: string, trace?: JsonValue): JsonValue {
+  const m: Record<string, JsonValue> = {
+    code: "warning", warning: message, warning_code: warningCode, retryable: false,
+  };
+  if (trace !== undefined) m.trace = trace;
+  return m;
+}
+
+/**
+ * Build {code: "batch", results, count, failed_count, trace?}.
+ * failed_count counts results whose code is "error".
+ */
+export function buildJsonBatch(results: JsonValue[], trace?: JsonValue): JsonValue {
+  let failed = 0;
+  for (const r of results) {
+    if (r !== null && typeof r === "object" && !Array.isArray(r) && r.code === "error") failed++;
+  }
+  const m: Record<string, JsonValue> = {
+    code: "batch", results: [...results], count: results.length, failed_count: failed,
+  };
+  if (trace !== undefined) m.trace = trace;
+  return m;
+}
+
+const ENV_SECRET_SUFFIXES = ["_KEY", "_TOKEN", "_SECRET"];
+const ENV_SECRET_SUBSTRINGS = ["PASSWORD"];
+
+/**
+ * Build the startup event {code: "log", event: "startup", config?, args?, env?}.
+ * Env values whose names end in _KEY, _TOKEN or _SECRET, or contain PASSWORD
+ * (case-insensitive), become "***" in a copy. null (unset) stays null, and
+ * undefined sections are omitted.
+ */
+export function buildJsonStartup(
+  config?: JsonValue, args?: JsonValue, env?: Record<string, JsonValue>,
+): JsonValue {
+  const m: Record<string, JsonValue> = { code: "log", event: "startup" };
+  if (config !== undefined) m.config = config;
+  if (args !== undefined) m.args = args;
+  if (env !== undefined) {
+    const masked: Record<string, JsonValue> = {};
+    for (const [k, v] of Object.entries(env)) {
+      masked[k] = v !== null && isSecretEnvName(k) ? "***" : v;
+    }
+    m.env = masked;
+  }
+  return m;
+}
+
+function isSecretEnvName(name: string): boolean {
+  const upper = name.toUpperCase();
+  return ENV_SECRET_SUFFIXES.some((s) => upper.endsWith(s)) || ENV_SECRET_SUBSTRINGS.some((s) => upper.includes(s));
+}
+
+/**
+ * Build a cursor page {code: "ok", result: items, next_cursor, has_next}.
+ * has_next is nextCursor !== ""; an empty cursor marks the last page.
+ */
+export function buildJsonCursor(items: JsonValue, nextCursor: string): JsonValue {
+  return { code: "ok", result: items, next_cursor: nextCursor, has_next: nextCursor !== "" };
+}
+
 /** Build {code: "<custom>", ...fields, trace?}. */
 export function buildJson(code: string, fields: JsonValue, trace?: JsonValue): JsonValue {
   const result: Record<string, JsonValue> = isObject(fields) ? { ...fields } : {};
@@ -92,30 +177,34 @@ export function internalRedactSecrets(value: JsonValue): void {
 
 /**
  * Parse a human-readable size string into bytes.
- * Accepts bare numbers or numbers followed by a unit letter (B/K/M/G/T).
- * Case-insensitive. Trims whitespace. Returns null for invalid input.
+ * Accepts bare numbers or numbers followed by a unit (B/K/M/G/T/P/E,
+ * KB/MB/GB/TB/PB/EB or KiB/MiB/GiB/TiB/PiB/EiB, all binary), optionally
+ * separated by whitespace ("10 MB").
+ * Case-insensitive. Trims whitespace. Numbers are plain decimals: signs,
+ * underscores and scientific notation ("1e3") are rejected. Returns null
+ * for invalid input or results past Number.MAX_SAFE_INTEGER.
  */
 export function parseSize(s: string): number | null {
-  s = s.trim();
-  if (!s) return null;
   const multipliers: Record<string, number> = {
-    b: 1, k: 1024, m: 1024 ** 2, g: 1024 ** 3, t: 1024 ** 4,
+    k: 1024, m: 1024 ** 2, g: 1024 ** 3, t: 1024 ** 4, p: 1024 ** 5, e: 1024 ** 6,
   };
-  const last = s[s.length - 1].toLowerCase();
-  let numStr: string;
-  let mult: number;
-  if (last in multipliers) {
-    numStr = s.slice(0, -1);
-    mult = multipliers[last];
-  } else if ((last >= "0" && last <= "9") || last === ".") {
-    numStr = s;
-    mult = 1;
-  } else {
-    return null;
+  let numStr = s.trim().toLowerCase();
+  let mult = 1;
+  if (numStr.endsWith("b")) {
+    numStr = numStr.slice(0, -1);
+    if (numStr.endsWith("i") && numStr[numStr.length - 2] in multipliers) {
+      numStr = numStr.slice(0, -1);
+    }
+  }
+  const unit = numStr[numStr.length - 1];
+  if (unit !== undefined && unit in multipliers) {
+    mult = multipliers[unit];
+    numStr = numStr.slice(0, -1);
   }
-  if (!numStr) return null;
+  numStr = numStr.replace(/[ \t]+$/, "");
+  if (!/^(?:[0-9]+\.?[0-9]*|\.[0-9]+)$/.test(numStr)) return null;
   const n = Number(numStr);
-  if (isNaN(n) || n < 0 || !isFinite(n)) return null;
+  if (!isFinite(n)) return null;
   const result = Math.trunc(n * mult);
   if (!Number.isSafeInteger(result)) return null;
   return result;
@@ -190,9 +279,45 @@ function isNum(value: JsonValue): value is number {
   return typeof value === "number";
 }
 
+// Numeric suffixes that accept one trailing digit as decimal places: latency_ms2.
+const PRECISION_SUFFIXES = ["_percent", "_ratio", "_btc", "_ms"];
+
+/** Format keys like "latency_ms2": the bare suffix's unit, rounded to the digit. */
+function tryPrecisionSuffix(key: string, value: JsonValue): [string, string] | null {
+  if (!/[0-9]$/.test(key)) return null;
+  const d = Number(key[key.length - 1]);
+  for (const suffix of PRECISION_SUFFIXES) {
+    const stripped = stripSuffixCI(key.slice(0, -1), suffix);
+    if (stripped === null) continue;
+    if (!isNum(value)) return null;
+    switch (suffix) {
+      case "_percent": return [stripped, `${value.toFixed(d)}%`];
+      case "_ratio": return [stripped, `${(value * 100).toFixed(d)}%`];
+      case "_btc": return [stripped, `${value.toFixed(d)} BTC`];
+      default:
+        if (Math.abs(value) >= 1000) return [stripped, `${(value / 1000).toFixed(d)}s`];
+        return [stripped, `${value.toFixed(d)}ms`];
+    }
+  }
+  return null;
+}
+
+// E.164: "+", then 1-15 digits, the first non-zero.
+const E164_RE = /^\+[1-9][0-9]{0,14}$/;
+
+// Explicit power-of-1024 size suffixes: integers scaled to bytes, rendered like _bytes.
+const BINARY_UNIT_SUFFIXES: [string, number][] = [["_kib", 2 ** 10], ["_mib", 2 ** 20], ["_gib", 2 ** 30], ["_tib", 2 ** 40]];
+
+// Longest first, so "_khz" is not read as "_hz".
+const FREQUENCY_SUFFIXES: [string, string][] = [["_ghz", "GHz"], ["_mhz", "MHz"], ["_khz", "kHz"], ["_hz", "Hz"]];
+
 function tryProcessField(key: string, value: JsonValue): [string, string] | null {
   let stripped: string | null;
 
+  // Group 0: numeric suffixes with an inline precision digit (latency_ms2)
+  const precise = tryPrecisionSuffix(key, value);
+  if (precise !== null) return precise;
+
   // Group 1: compound timestamp suffixes
   stripped = stripSuffixCI(key, "_epoch_ms");
   if (stripped !== null) {
@@ -213,18 +338,18 @@ function tryProcessField(key: string, value: JsonValue): [string, string] | null
   // Group 2: compound currency suffixes
   stripped = stripSuffixCI(key, "_usd_cents");
   if (stripped !== null) {
-    if (isInt(value) && value >= 0) return [stripped, `$${Math.floor(value / 100)}.${String(value % 100).padStart(2, "0")}`];
+    if (isInt(value)) return [stripped, `${centsSign(value)}$${formatCents(value)}`];
     return null;
   }
   stripped = stripSuffixCI(key, "_eur_cents");
   if (stripped !== null) {
-    if (isInt(value) && value >= 0) return [stripped, `\u20ac${Math.floor(value / 100)}.${String(value % 100).padStart(2, "0")}`];
+    if (isInt(value)) return [stripped, `${centsSign(value)}\u20ac${formatCents(value)}`];
     return null;
   }
   const gc = tryStripGenericCents(key);
   if (gc !== null) {
     const [gcStripped, code] = gc;
-    if (isInt(value) && value >= 0) return [gcStripped, `${Math.floor(value / 100)}.${String(value % 100).padStart(2, "0")} ${code.toUpperCase()}`];
+    if (isInt(value)) return [gcStripped, `${centsSign(value)}${formatCents(value)} ${code.toUpperCase()}`];
     return null;
   }
 
@@ -234,6 +359,24 @@ function tryProcessField(key: string, value: JsonValue): [string, string] | null
     if (typeof value === "string") return [stripped, value];
     return null;
   }
+  stripped = stripSuffixCI(key, "_e164");
+  if (stripped !== null) {
+    if (typeof value === "string" && E164_RE.test(value)) return [stripped, value];
+    return null;
+  }
+  stripped = stripSuffixCI(key, "_base64");
+  if (stripped !== null) {
+    if (typeof value === "string") {
+      const decoded = decodeBase64(value);
+      if (decoded !== null) return [stripped, printableText(decoded) ?? value];
+    }
+    return null;
+  }
+  stripped = stripSuffixCI(key, "_hex");
+  if (stripped !== null) {
+    if (isInt(value) && value >= 0 && Number.isSafeInteger(value)) return [stripped, `0x${value.toString(16)}`];
+    return null;
+  }
   stripped = stripSuffixCI(key, "_minutes");
   if (stripped !== null) {
     if (isNum(value)) return [stripped, `${plainScalar(value)} minutes`];
@@ -249,6 +392,20 @@ function tryProcessField(key: string, value: JsonValue): [string, string] | null
     if (isNum(value)) return [stripped, `${plainScalar(value)} days`];
     return null;
   }
+  for (const suffix of ["_rate_per_second", "_rps"]) {
+    stripped = stripSuffixCI(key, suffix);
+    if (stripped !== null) {
+      if (isNum(value)) return [stripped, formatRate(value)];
+      return null;
+    }
+  }
+  for (const [suffix, unit] of FREQUENCY_SUFFIXES) {
+    stripped = stripSuffixCI(key, suffix);
+    if (stripped !== null) {
+      if (isNum(value)) return [stripped, `${plainScalar(value)} ${unit}`];
+      return null;
+    }
+  }
 
   // Group 4: single-unit suffixes
   stripped = stripSuffixCI(key, "_msats");
@@ -264,13 +421,29 @@ function tryProcessField(key: string, value: JsonValue): [string, string] | null
   stripped = stripSuffixCI(key, "_bytes");
   if (stripped !== null) {
     if (isInt(value)) return [stripped, formatBytesHuman(value)];
+    // Fractional byte counts (e.g. averages) round half away from zero.
+    if (isNum(value) && Number.isFinite(value)) {
+      return [stripped, formatBytesHuman(Math.sign(value) * Math.round(Math.abs(value)))];
+    }
     return null;
   }
+  for (const [suffix, mult] of BINARY_UNIT_SUFFIXES) {
+    stripped = stripSuffixCI(key, suffix);
+    if (stripped !== null) {
+      if (isInt(value) && Math.abs(value * mult) < 2 ** 63) return [stripped, formatBytesHuman(value * mult)];
+      return null;
+    }
+  }
   stripped = stripSuffixCI(key, "_percent");
   if (stripped !== null) {
     if (isNum(value)) return [stripped, `${plainScalar(value)}%`];
     return null;
   }
+  stripped = stripSuffixCI(key, "_ratio");
+  if (stripped !== null) {
+    if (isNum(value)) return [stripped, formatRatio(value)];
+    return null;
+  }
   stripped = stripSuffixCI(key, "_secret");
   if (stripped !== null) return [stripped, "***"];
 
@@ -363,6 +536,45 @@ function formatMsValue(value: JsonValue): string | null {
   return `${plainScalar(value)}ms`;
 }
 
+/** Decode standard or URL-safe base64, padded or not. null if invalid. */
+function decodeBase64(s: string): Uint8Array | null {
+  if (!/^([A-Za-z0-9+/]*|[A-Za-z0-9_-]*)={0,2}$/.test(s)) return null;
+  const padded = s.includes("=");
+  if (s.length === 0 || (padded ? s.length % 4 !== 0 : s.length % 4 === 1)) return null;
+  const bin = atob(s.replace(/-/g, "+").replace(/_/g, "/"));
+  return Uint8Array.from(bin, (c) => c.charCodeAt(0));
+}
+
+/** Decode b as text if it is UTF-8 with no control characters but \n, \t, \r. */
+function printableText(b: Uint8Array): string | null {
+  let text: string;
+  try {
+    text = new TextDecoder("utf-8", { fatal: true, ignoreBOM: true }).decode(b);
+  } catch {
+    return null;
+  }
+  return /[\u0000-\u0008\u000b\u000c\u000e-\u001f\u007f-\u009f]/.test(text) ? null : text;
+}
+
+/** Format a fraction as a percentage to 9 decimals, zeros trimmed: 0.875 → "87.5%". */
+function formatRatio(n: number): string {
+  return (n * 100).toFixed(9).replace(/0+$/, "").replace(/\.$/, "") + "%";
+}
+
+/** Format a per-second rate with base-1000 promotion: 1523.4 → "1.5k/s". */
+function formatRate(n: number): string {
+  let sign = n < 0 ? "-" : "";
+  n = Math.abs(n);
+  const units = ["", "k", "M", "G", "T"];
+  let i = 0;
+  while (i < units.length - 1 && Math.round(n * 10) / 10 >= 1000) {
+    n /= 1000;
+    i++;
+  }
+  if (n === 0) sign = "";
+  return `${sign}${n.toFixed(1)}${units[i]}/s`;
+}
+
 function formatRfc3339Ms(ms: number): string {
   try {
     const d = new Date(ms);
@@ -386,6 +598,17 @@ function formatBytesHuman(bytes: number): string {
   return `${bytes}B`;
 }
 
+/** Cents as an unsigned grouped major amount: 123456 and -123456 → "1,234.56". */
+function formatCents(n: number): string {
+  const abs = Math.abs(n);
+  return `${formatWithCommas(Math.floor(abs / 100))}.${String(abs % 100).padStart(2, "0")}`;
+}
+
+/** The sign of a cents amount, placed before the currency symbol. */
+function centsSign(n: number): string {
+  return n < 0 ? "-" : "";
+}
+
 function formatWithCommas(n: number): string {
   const s = String(n);
   const result: string[] = [];
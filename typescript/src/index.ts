@@ -5,6 +5,12 @@
 export {
   buildJsonOk,
   buildJsonError,
+  buildJsonErrorCode,
+  buildJsonErrors,
+  buildJsonWarning,
+  buildJsonCursor,
+  buildJsonStartup,
+  buildJsonBatch,
   buildJson,
   RedactionPolicy,
   outputJson,